@@ -0,0 +1,304 @@
+package xisdb
+
+import (
+	"math"
+	"strconv"
+)
+
+// Atomic operations read a key and write it again within a single transaction, so nothing can
+// change it in between. Incrementing or appending to a key keeps its expiration, while the
+// operations that set it outright, like Set, replace it
+
+// Incr adds 1 to the integer at the key, returning the result
+func (tx *Tx) Incr(key string) (int64, error) {
+	return tx.IncrBy(key, 1)
+}
+
+// IncrBy adds n to the integer at the key, returning the result. A key that doesn't exist
+// starts at 0, a value that isn't an integer is ErrNotInteger
+func (tx *Tx) IncrBy(key string, n int64) (int64, error) {
+	if err := tx.checkWrite(); err != nil {
+		return 0, err
+	}
+	return tx.incrBy(tx.db.root(), key, n)
+}
+
+func (tx *Tx) incrBy(b *bucket, key string, n int64) (int64, error) {
+	item, exists := tx.lookup(b, key)
+	var value int64
+	if exists {
+		v, err := strconv.ParseInt(item.Value, 10, 64)
+		if err != nil {
+			return 0, ErrNotInteger
+		}
+		value = v
+	}
+	if (n > 0 && value > math.MaxInt64-n) || (n < 0 && value < math.MinInt64-n) {
+		return 0, ErrNumberOverflow
+	}
+
+	value += n
+	tx.update(b, key, strconv.FormatInt(value, 10), item)
+	return value, nil
+}
+
+// IncrByFloat adds f to the number at the key, returning the result. A key that doesn't exist
+// starts at 0, a value that isn't a number is ErrNotNumber
+func (tx *Tx) IncrByFloat(key string, f float64) (float64, error) {
+	if err := tx.checkWrite(); err != nil {
+		return 0, err
+	}
+	return tx.incrByFloat(tx.db.root(), key, f)
+}
+
+func (tx *Tx) incrByFloat(b *bucket, key string, f float64) (float64, error) {
+	item, exists := tx.lookup(b, key)
+	var value float64
+	if exists {
+		v, err := strconv.ParseFloat(item.Value, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return 0, ErrNotNumber
+		}
+		value = v
+	}
+
+	value += f
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, ErrNumberOverflow
+	}
+	tx.update(b, key, strconv.FormatFloat(value, 'f', -1, 64), item)
+	return value, nil
+}
+
+// Append adds value to the end of the key's value, or sets it if the key doesn't exist,
+// returning the length of the result
+func (tx *Tx) Append(key, value string) (int, error) {
+	if err := tx.checkWrite(); err != nil {
+		return 0, err
+	}
+	return tx.append(tx.db.root(), key, value)
+}
+
+func (tx *Tx) append(b *bucket, key, value string) (int, error) {
+	item, exists := tx.lookup(b, key)
+	if exists {
+		value = item.Value + value
+	}
+	tx.update(b, key, value, item)
+	return len(value), nil
+}
+
+// GetSet sets the key to value, returning its old value and whether or not it existed
+func (tx *Tx) GetSet(key, value string) (string, bool, error) {
+	if err := tx.checkWrite(); err != nil {
+		return "", false, err
+	}
+	return tx.getSet(tx.db.root(), key, value)
+}
+
+func (tx *Tx) getSet(b *bucket, key, value string) (string, bool, error) {
+	item, exists := tx.lookup(b, key)
+	if err := tx.set(b, key, value, nil); err != nil {
+		return "", false, err
+	}
+	if !exists {
+		return "", false, nil
+	}
+	return item.Value, true, nil
+}
+
+// SetNX sets the key to value only if it doesn't exist, returning whether or not it was set
+func (tx *Tx) SetNX(key, value string) (bool, error) {
+	if err := tx.checkWrite(); err != nil {
+		return false, err
+	}
+	return tx.setIf(tx.db.root(), key, value, false)
+}
+
+// SetXX sets the key to value only if it already exists, returning whether or not it was set
+func (tx *Tx) SetXX(key, value string) (bool, error) {
+	if err := tx.checkWrite(); err != nil {
+		return false, err
+	}
+	return tx.setIf(tx.db.root(), key, value, true)
+}
+
+// setIf sets the key to value if whether or not it exists is as expected
+func (tx *Tx) setIf(b *bucket, key, value string, exists bool) (bool, error) {
+	if _, found := tx.lookup(b, key); found != exists {
+		return false, nil
+	}
+	return true, tx.set(b, key, value, nil)
+}
+
+// CompareAndSwap sets the key to new only if its value is old, returning whether or not it was
+// swapped. A key that doesn't exist is never swapped
+func (tx *Tx) CompareAndSwap(key, old, new string) (bool, error) {
+	if err := tx.checkWrite(); err != nil {
+		return false, err
+	}
+	return tx.compareAndSwap(tx.db.root(), key, old, new)
+}
+
+func (tx *Tx) compareAndSwap(b *bucket, key, old, new string) (bool, error) {
+	item, exists := tx.lookup(b, key)
+	if !exists || item.Value != old {
+		return false, nil
+	}
+	tx.update(b, key, new, item)
+	return true, nil
+}
+
+// update sets the key to value, keeping the metadata of the item it's replacing, if there is one.
+// A new key gets the bucket's default TTL
+func (tx *Tx) update(b *bucket, key, value string, item *Item) {
+	md := &itemMetadata{expiration: b.defaultExpiration()}
+	if item != nil && item.metadata != nil {
+		*md = *item.metadata
+	}
+	tx.insert(b, &Item{key, value, md})
+}
+
+// Incr adds 1 to the integer at the key, returning the result
+func (b *Bucket) Incr(key string) (int64, error) {
+	return b.IncrBy(key, 1)
+}
+
+// IncrBy adds n to the integer at the key, returning the result
+func (b *Bucket) IncrBy(key string, n int64) (int64, error) {
+	if err := b.tx.checkWrite(); err != nil {
+		return 0, err
+	}
+	return b.tx.incrBy(b.managed, key, n)
+}
+
+// IncrByFloat adds f to the number at the key, returning the result
+func (b *Bucket) IncrByFloat(key string, f float64) (float64, error) {
+	if err := b.tx.checkWrite(); err != nil {
+		return 0, err
+	}
+	return b.tx.incrByFloat(b.managed, key, f)
+}
+
+// Append adds value to the end of the key's value, returning the length of the result
+func (b *Bucket) Append(key, value string) (int, error) {
+	if err := b.tx.checkWrite(); err != nil {
+		return 0, err
+	}
+	return b.tx.append(b.managed, key, value)
+}
+
+// GetSet sets the key to value, returning its old value and whether or not it existed
+func (b *Bucket) GetSet(key, value string) (string, bool, error) {
+	if err := b.tx.checkWrite(); err != nil {
+		return "", false, err
+	}
+	return b.tx.getSet(b.managed, key, value)
+}
+
+// SetNX sets the key to value only if it doesn't exist, returning whether or not it was set
+func (b *Bucket) SetNX(key, value string) (bool, error) {
+	if err := b.tx.checkWrite(); err != nil {
+		return false, err
+	}
+	return b.tx.setIf(b.managed, key, value, false)
+}
+
+// SetXX sets the key to value only if it already exists, returning whether or not it was set
+func (b *Bucket) SetXX(key, value string) (bool, error) {
+	if err := b.tx.checkWrite(); err != nil {
+		return false, err
+	}
+	return b.tx.setIf(b.managed, key, value, true)
+}
+
+// CompareAndSwap sets the key to new only if its value is old, returning whether or not it was swapped
+func (b *Bucket) CompareAndSwap(key, old, new string) (bool, error) {
+	if err := b.tx.checkWrite(); err != nil {
+		return false, err
+	}
+	return b.tx.compareAndSwap(b.managed, key, old, new)
+}
+
+// Incr adds 1 to the integer at the key, returning the result
+func (db *DB) Incr(key string) (int64, error) {
+	return db.IncrBy(key, 1)
+}
+
+// IncrBy adds n to the integer at the key, returning the result
+func (db *DB) IncrBy(key string, n int64) (int64, error) {
+	var value int64
+	err := db.ReadWrite(func(tx *Tx) error {
+		v, err := tx.IncrBy(key, n)
+		value = v
+		return err
+	})
+	return value, err
+}
+
+// IncrByFloat adds f to the number at the key, returning the result
+func (db *DB) IncrByFloat(key string, f float64) (float64, error) {
+	var value float64
+	err := db.ReadWrite(func(tx *Tx) error {
+		v, err := tx.IncrByFloat(key, f)
+		value = v
+		return err
+	})
+	return value, err
+}
+
+// Append adds value to the end of the key's value, returning the length of the result
+func (db *DB) Append(key, value string) (int, error) {
+	var length int
+	err := db.ReadWrite(func(tx *Tx) error {
+		n, err := tx.Append(key, value)
+		length = n
+		return err
+	})
+	return length, err
+}
+
+// GetSet sets the key to value, returning its old value and whether or not it existed
+func (db *DB) GetSet(key, value string) (string, bool, error) {
+	var old string
+	var existed bool
+	err := db.ReadWrite(func(tx *Tx) error {
+		v, e, err := tx.GetSet(key, value)
+		old, existed = v, e
+		return err
+	})
+	return old, existed, err
+}
+
+// SetNX sets the key to value only if it doesn't exist, returning whether or not it was set
+func (db *DB) SetNX(key, value string) (bool, error) {
+	var set bool
+	err := db.ReadWrite(func(tx *Tx) error {
+		s, err := tx.SetNX(key, value)
+		set = s
+		return err
+	})
+	return set, err
+}
+
+// SetXX sets the key to value only if it already exists, returning whether or not it was set
+func (db *DB) SetXX(key, value string) (bool, error) {
+	var set bool
+	err := db.ReadWrite(func(tx *Tx) error {
+		s, err := tx.SetXX(key, value)
+		set = s
+		return err
+	})
+	return set, err
+}
+
+// CompareAndSwap sets the key to new only if its value is old, returning whether or not it was swapped
+func (db *DB) CompareAndSwap(key, old, new string) (bool, error) {
+	var swapped bool
+	err := db.ReadWrite(func(tx *Tx) error {
+		s, err := tx.CompareAndSwap(key, old, new)
+		swapped = s
+		return err
+	})
+	return swapped, err
+}
@@ -0,0 +1,260 @@
+package xisdb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alexsward/xisdb/ql"
+)
+
+func TestAtomicIncr(t *testing.T) {
+	fmt.Println("-- TestAtomicIncr")
+	tests := []struct {
+		value    string
+		exists   bool
+		by       int64
+		expected int64
+		err      error
+	}{
+		{"", false, 1, 1, nil},
+		{"10", true, 1, 11, nil},
+		{"10", true, -20, -10, nil},
+		{"-5", true, 5, 0, nil},
+		{"abc", true, 1, 0, ErrNotInteger},
+		{"1.5", true, 1, 0, ErrNotInteger},
+		{"", true, 1, 0, ErrNotInteger},
+		{strconv.FormatInt(math.MaxInt64, 10), true, 1, 0, ErrNumberOverflow},
+		{strconv.FormatInt(math.MinInt64, 10), true, -1, 0, ErrNumberOverflow},
+		{strconv.FormatInt(math.MaxInt64-1, 10), true, 1, math.MaxInt64, nil},
+	}
+	for i, test := range tests {
+		db := openTestDB()
+		if test.exists {
+			db.Set("key", test.value)
+		}
+		value, err := db.IncrBy("key", test.by)
+		if err != test.err {
+			t.Errorf("Test %d failed: expected error '%s', got '%s'", i+1, test.err, err)
+			continue
+		}
+		if test.err != nil {
+			assertDBKeyValue(t, db, "key", test.value, test.exists)
+			continue
+		}
+		if value != test.expected {
+			t.Errorf("Test %d failed: expected %d, got %d", i+1, test.expected, value)
+		}
+		assertDBKeyValue(t, db, "key", strconv.FormatInt(test.expected, 10), true)
+	}
+}
+
+func TestAtomicIncrByFloat(t *testing.T) {
+	fmt.Println("-- TestAtomicIncrByFloat")
+	tests := []struct {
+		value    string
+		exists   bool
+		by       float64
+		expected float64
+		stored   string
+		err      error
+	}{
+		{"", false, 1.5, 1.5, "1.5", nil},
+		{"10", true, 0.25, 10.25, "10.25", nil},
+		{"1.5", true, -1.5, 0, "0", nil},
+		{"abc", true, 1, 0, "", ErrNotNumber},
+		{"NaN", true, 1, 0, "", ErrNotNumber},
+		{"1e308", true, 1e308, 0, "", ErrNumberOverflow},
+		{"1", true, math.Inf(1), 0, "", ErrNumberOverflow},
+	}
+	for i, test := range tests {
+		db := openTestDB()
+		if test.exists {
+			db.Set("key", test.value)
+		}
+		value, err := db.IncrByFloat("key", test.by)
+		if err != test.err {
+			t.Errorf("Test %d failed: expected error '%s', got '%s'", i+1, test.err, err)
+			continue
+		}
+		if test.err != nil {
+			continue
+		}
+		if value != test.expected {
+			t.Errorf("Test %d failed: expected %f, got %f", i+1, test.expected, value)
+		}
+		assertDBKeyValue(t, db, "key", test.stored, true)
+	}
+}
+
+func TestAtomicSetIf(t *testing.T) {
+	fmt.Println("-- TestAtomicSetIf")
+	tests := []struct {
+		op       func(db *DB) (bool, error)
+		exists   bool
+		set      bool
+		expected string
+	}{
+		{func(db *DB) (bool, error) { return db.SetNX("key", "new") }, false, true, "new"},
+		{func(db *DB) (bool, error) { return db.SetNX("key", "new") }, true, false, "value"},
+		{func(db *DB) (bool, error) { return db.SetXX("key", "new") }, false, false, ""},
+		{func(db *DB) (bool, error) { return db.SetXX("key", "new") }, true, true, "new"},
+		{func(db *DB) (bool, error) { return db.CompareAndSwap("key", "value", "new") }, true, true, "new"},
+		{func(db *DB) (bool, error) { return db.CompareAndSwap("key", "other", "new") }, true, false, "value"},
+		{func(db *DB) (bool, error) { return db.CompareAndSwap("key", "", "new") }, false, false, ""},
+	}
+	for i, test := range tests {
+		db := openTestDB()
+		if test.exists {
+			db.Set("key", "value")
+		}
+		set, err := test.op(db)
+		if err != nil {
+			t.Errorf("Test %d failed: unexpected error '%s'", i+1, err)
+			continue
+		}
+		if set != test.set {
+			t.Errorf("Test %d failed: expected set to be %t, got %t", i+1, test.set, set)
+		}
+		exists, _ := db.Exists("key")
+		if exists != (test.exists || test.set) {
+			t.Errorf("Test %d failed: expected key to exist: %t, got %t", i+1, test.exists || test.set, exists)
+		}
+		assertDBKeyValue(t, db, "key", test.expected, exists)
+	}
+}
+
+func TestAtomicGetSetAppend(t *testing.T) {
+	fmt.Println("-- TestAtomicGetSetAppend")
+	db := openTestDB()
+	if old, existed, err := db.GetSet("key", "value"); err != nil || existed || old != "" {
+		t.Errorf("Expected GetSet of a missing key to return '', false, nil, got '%s', %t, %v", old, existed, err)
+	}
+	if old, existed, err := db.GetSet("key", "new"); err != nil || !existed || old != "value" {
+		t.Errorf("Expected GetSet to return 'value', true, nil, got '%s', %t, %v", old, existed, err)
+	}
+	if length, err := db.Append("key", "er"); err != nil || length != 5 {
+		t.Errorf("Expected Append to return 5, nil, got %d, %v", length, err)
+	}
+	assertDBKeyValue(t, db, "key", "newer", true)
+	if length, err := db.Append("other", "abc"); err != nil || length != 3 {
+		t.Errorf("Expected Append of a missing key to return 3, nil, got %d, %v", length, err)
+	}
+	assertDBKeyValue(t, db, "other", "abc", true)
+}
+
+func TestAtomicExpiration(t *testing.T) {
+	fmt.Println("-- TestAtomicExpiration")
+	tests := []struct {
+		op   func(tx *Tx) error
+		keep bool
+	}{
+		{func(tx *Tx) error { _, err := tx.Incr("key"); return err }, true},
+		{func(tx *Tx) error { _, err := tx.IncrByFloat("key", 0.5); return err }, true},
+		{func(tx *Tx) error { _, err := tx.Append("key", "0"); return err }, true},
+		{func(tx *Tx) error { _, err := tx.CompareAndSwap("key", "1", "2"); return err }, true},
+		{func(tx *Tx) error { _, _, err := tx.GetSet("key", "2"); return err }, false},
+		{func(tx *Tx) error { _, err := tx.SetXX("key", "2"); return err }, false},
+	}
+	for i, test := range tests {
+		db := openTestDB()
+		db.ReadWrite(func(tx *Tx) error {
+			return tx.Set("key", "1", &SetMetadata{TTL: int64(time.Hour / time.Millisecond)})
+		})
+		if err := db.ReadWrite(test.op); err != nil {
+			t.Errorf("Test %d failed: unexpected error '%s'", i+1, err)
+			continue
+		}
+		item, _ := db.root().get("key", latest)
+		if item.Value == "1" {
+			t.Errorf("Test %d failed: expected the value to change", i+1)
+		}
+		if kept := item.expiresAt() != 0; kept != test.keep {
+			t.Errorf("Test %d failed: expected the expiration to be kept: %t, got %t", i+1, test.keep, kept)
+		}
+	}
+}
+
+func TestAtomicTransactions(t *testing.T) {
+	fmt.Println("-- TestAtomicTransactions")
+	db := openTestDB()
+	db.Set("key", "10")
+	failure := errors.New("failure")
+	err := db.ReadWrite(func(tx *Tx) error {
+		if _, err := tx.Incr("key"); err != nil {
+			return err
+		}
+		b, err := tx.Bucket("bucket")
+		if err != nil {
+			return err
+		}
+		if _, err := b.IncrBy("counter", 5); err != nil {
+			return err
+		}
+		if value, _ := b.Get("counter"); value != "5" {
+			t.Errorf("Expected bucket counter to be 5, got '%s'", value)
+		}
+		if value, _ := tx.Get("counter"); value != "" {
+			t.Errorf("Expected the bucket counter to not be in the root bucket, got '%s'", value)
+		}
+		return failure
+	})
+	if err != failure {
+		t.Errorf("Expected error '%s', got '%s'", failure, err)
+	}
+	assertDBKeyValue(t, db, "key", "10", true)
+
+	err = db.Read(func(tx *Tx) error {
+		_, err := tx.Incr("key")
+		return err
+	})
+	if err != ErrNotWriteTransaction {
+		t.Errorf("Expected error '%s', got '%s'", ErrNotWriteTransaction, err)
+	}
+	assertDBKeyValue(t, db, "key", "10", true)
+}
+
+func TestAtomicQueryLanguage(t *testing.T) {
+	fmt.Println("-- TestAtomicQueryLanguage")
+	tests := []struct {
+		statement string
+		expected  Item
+		value     string
+	}{
+		{"incr counter;", Item{"counter", "11", nil}, "11"},
+		{"incrby counter -5;", Item{"counter", "5", nil}, "5"},
+		{"incrbyfloat counter 0.5;", Item{"counter", "10.5", nil}, "10.5"},
+		{"append counter 0;", Item{"counter", "3", nil}, "100"},
+		{"getset counter 20;", Item{"counter", "10", nil}, "20"},
+		{"setnx counter 20;", Item{"counter", "false", nil}, "10"},
+		{"setxx counter 20;", Item{"counter", "true", nil}, "20"},
+		{"cas counter 10 20;", Item{"counter", "true", nil}, "20"},
+		{"cas counter 11 20;", Item{"counter", "false", nil}, "10"},
+	}
+	for i, test := range tests {
+		db := openTestDB()
+		db.Set("counter", "10")
+		statements, err := ql.Parse(test.statement)
+		if err != nil {
+			t.Errorf("Test %d failed: error parsing '%s': %s", i+1, test.statement, err)
+			continue
+		}
+		ch := make(chan Item)
+		qe := QueryEngine{}
+		qe.Execute(statements, &QueryEngineContext{DB: db, Results: ch})
+		select {
+		case item := <-ch:
+			if item.Key != test.expected.Key || item.Value != test.expected.Value {
+				t.Errorf("Test %d failed: expected result %s=%s, got %s=%s", i+1, test.expected.Key, test.expected.Value, item.Key, item.Value)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("Test %d failed: timed out waiting for a result", i+1)
+			continue
+		}
+		<-ch // closed once the statement's transaction is done
+		assertDBKeyValue(t, db, "counter", test.value, true)
+	}
+}
@@ -0,0 +1,108 @@
+package xisdb
+
+import (
+	"bufio"
+	"context"
+	"io"
+)
+
+// Backup writes a consistent snapshot of every bucket, item and expiration in the database
+// to w. It's read like any other read transaction, so writers are never held up while it's
+// written out, record by record. A backup is laid out just like a compacted database file,
+// so besides being passed to Restore it can be opened directly as a database. It's encrypted
+// with the same key as the database, if there is one
+func (db *DB) Backup(w io.Writer) error {
+	// the buckets are captured along with the version of their items, and the last transaction in it
+	db.lock()
+	tx, err := db.begin(context.Background(), false)
+	if err != nil {
+		db.unlock()
+		return err
+	}
+	id, buckets := db.lastID, db.snapshotBuckets()
+	c, compression := db.cipher, db.compression
+	db.unlock()
+	defer tx.Rollback()
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(fileHeader(compression)); err != nil {
+		return err
+	}
+	pack := func(record []byte) []byte {
+		return c.seal(compression.compress(record))
+	}
+	err = encodeSnapshot(id, tx.version, buckets, pack, func(record []byte) error {
+		_, err := bw.Write(frameRecord(record))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Restore replaces everything in the database with the contents of a backup, committing
+// whatever changes are needed as a single transaction. The entire backup is read and
+// validated first, so nothing changes if it's incomplete or corrupted
+func (db *DB) Restore(r io.Reader) error {
+	db.lock()
+	c := db.cipher
+	db.unlock()
+
+	restored, err := readBackup(r, c)
+	if err != nil {
+		return err
+	}
+
+	return db.ReadWrite(func(tx *Tx) error {
+		return tx.restore(restored.buckets)
+	})
+}
+
+// readBackup rebuilds the database held in a backup, decrypting it with the cipher.
+// The backup must contain a complete snapshot
+func readBackup(r io.Reader, c *recordCipher) (*DB, error) {
+	br := bufio.NewReader(r)
+	header, _ := br.Peek(len(fileHeader(CompressionNone)))
+	n, _, err := parseFileHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	br.Discard(n)
+
+	restored := newReplayDB()
+	started, ended := false, false
+	for {
+		record, err := readFrame(br, -1)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, ErrIncorrectDatabaseFileFormat
+		}
+		if record, err = unpack(c, record); err != nil {
+			return nil, err
+		}
+
+		d := &decoder{buf: record}
+		kind, id, commits := d.record()
+		if d.err != nil {
+			return nil, d.err
+		}
+		if err := restored.apply(commits); err != nil {
+			return nil, err
+		}
+		restored.lastID = id
+		switch kind {
+		case recordSnapshot:
+			started, ended = true, false
+		case recordSnapshotEnd:
+			started, ended = true, true
+		}
+	}
+
+	if !started || !ended {
+		return nil, ErrIncorrectDatabaseFileFormat
+	}
+	return restored, nil
+}
@@ -0,0 +1,150 @@
+package xisdb
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	fmt.Println("-- TestBackupRestore")
+	db := openTestDB()
+	db.Set("key", "value")
+	db.ReadWrite(func(tx *Tx) error {
+		return tx.Set("expires", "value", &SetMetadata{TTL: 60000})
+	})
+	db.ReadWrite(func(tx *Tx) error {
+		b, _ := tx.Bucket("b1")
+		return b.Set("bucketkey", "bucketvalue")
+	})
+
+	var backup bytes.Buffer
+	if err := db.Backup(&backup); err != nil {
+		t.Fatalf("Error backing up database: %s", err)
+	}
+
+	restored := openTestDB()
+	restored.Set("key", "other")
+	restored.Set("extra", "value")
+	restored.Bucket("b2")
+	if err := restored.Restore(bytes.NewReader(backup.Bytes())); err != nil {
+		t.Fatalf("Error restoring database: %s", err)
+	}
+	assertDBKeyValue(t, restored, "key", "value", true)
+	assertBucketExists(t, restored, "b1", true)
+	assertBucketExists(t, restored, "b2", false)
+	if exists, _ := restored.Exists("extra"); exists {
+		t.Errorf("Expected key not in the backup to be removed by restoring")
+	}
+	if item, exists := restored.buckets["b1"].get("bucketkey", latest); !exists || item.Value != "bucketvalue" {
+		t.Errorf("Expected bucketkey in bucket b1 after restoring, got %v", item)
+	}
+	original, _ := db.root().get("expires", latest)
+	if item, exists := restored.root().get("expires", latest); !exists || item.expiresAt() != original.expiresAt() {
+		t.Errorf("Expected key 'expires' to keep its expiration after restoring")
+	}
+
+	// a backup can be opened directly as a database file
+	filename := filepath.Join(t.TempDir(), "backup.data")
+	os.WriteFile(filename, backup.Bytes(), 0666)
+	opened := openTestFileDB(t, filename)
+	defer opened.Close()
+	assertDBKeyValue(t, opened, "key", "value", true)
+	assertBucketExists(t, opened, "b1", true)
+}
+
+func TestBackupWhileWriting(t *testing.T) {
+	fmt.Println("-- TestBackupWhileWriting")
+	db := openTestDB()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			db.ReadWrite(func(tx *Tx) error {
+				// both keys always change together
+				tx.Set("a", strconv.Itoa(i), nil)
+				return tx.Set("b", strconv.Itoa(i), nil)
+			})
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		var backup bytes.Buffer
+		if err := db.Backup(&backup); err != nil {
+			t.Fatalf("Error backing up database: %s", err)
+		}
+		restored := openTestDB()
+		if err := restored.Restore(&backup); err != nil {
+			t.Fatalf("Error restoring database: %s", err)
+		}
+		a, _ := restored.Get("a")
+		b, _ := restored.Get("b")
+		if a != b {
+			t.Errorf("Expected a consistent backup, got a=%s and b=%s", a, b)
+		}
+	}
+	wg.Wait()
+}
+
+// writerFunc is an io.Writer that calls a function with everything written to it
+type writerFunc func(p []byte) (int, error)
+
+func (fn writerFunc) Write(p []byte) (int, error) {
+	return fn(p)
+}
+
+func TestBackupDoesNotBlockWriters(t *testing.T) {
+	fmt.Println("-- TestBackupDoesNotBlockWriters")
+	db := openTestDB()
+	db.Set("key", "value")
+
+	// the backup is written out as the key changes, and still has the value from when it began
+	var backup bytes.Buffer
+	err := db.Backup(writerFunc(func(p []byte) (int, error) {
+		if err := db.Set("key", "changed"); err != nil {
+			return 0, err
+		}
+		return backup.Write(p)
+	}))
+	if err != nil {
+		t.Fatalf("Error backing up database: %s", err)
+	}
+	restored := openTestDB()
+	if err := restored.Restore(&backup); err != nil {
+		t.Fatalf("Error restoring database: %s", err)
+	}
+	assertDBKeyValue(t, restored, "key", "value", true)
+	assertDBKeyValue(t, db, "key", "changed", true)
+}
+
+func TestBackupRestoreInvalid(t *testing.T) {
+	fmt.Println("-- TestBackupRestoreInvalid")
+	db := openTestDB()
+	for i := 0; i < 10; i++ {
+		db.Set(strconv.Itoa(i), "value")
+	}
+	var backup bytes.Buffer
+	db.Backup(&backup)
+	full := backup.Bytes()
+
+	tests := [][]byte{
+		{},
+		[]byte("not a backup"),
+		full[:len(fileHeader(CompressionNone))],
+		full[:len(full)-1],
+		corrupt(full, len(full)/2),
+	}
+	for i, test := range tests {
+		restored := openTestDB()
+		restored.Set("key", "value")
+		if err := restored.Restore(bytes.NewReader(test)); err != ErrIncorrectDatabaseFileFormat {
+			t.Errorf("Test %d failed: expected error '%s', got '%s'", i+1, ErrIncorrectDatabaseFileFormat, err)
+		}
+		assertDBKeyValue(t, restored, "key", "value", true)
+	}
+}
@@ -0,0 +1,103 @@
+package xisdb
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxBatchSize  = 1000
+	defaultMaxBatchDelay = 10 * time.Millisecond
+)
+
+// errBatchRetry is sent to every call of a batch that failed as a whole, so each one is run again on its own
+var errBatchRetry = errors.New("Batch failed, run the call on its own")
+
+// batch is a group of calls to Batch that are run, and committed, in a single write transaction
+type batch struct {
+	db    *DB
+	timer *time.Timer
+	start sync.Once
+	calls []batchCall
+}
+
+// batchCall is a single caller's fn, and where its result is sent
+type batchCall struct {
+	fn  func(tx *Tx) error
+	err chan error
+}
+
+// Batch runs fn in a write transaction shared with other concurrent calls to Batch, so they're all
+// committed, and written to the storage, at once. A batch runs once it has Options.MaxBatchSize
+// calls, or Options.MaxBatchDelay after its first one. If fn returns an error, only what it changed
+// is undone, and the error is returned. If the batch fails as a whole, each fn is run again in a
+// transaction of its own, so fn must be safe to run more than once. Batch only returns once its
+// batch has been committed, so it's best used by many goroutines calling it at once
+func (db *DB) Batch(fn func(tx *Tx) error) error {
+	if db.readOnly {
+		return ErrDatabaseReadOnly
+	}
+
+	call := batchCall{fn, make(chan error, 1)}
+	db.batchMutex.Lock()
+	if db.batch == nil {
+		db.batch = &batch{db: db}
+		db.batch.timer = time.AfterFunc(db.maxBatchDelay, db.batch.trigger)
+	}
+	db.batch.calls = append(db.batch.calls, call)
+	if len(db.batch.calls) >= db.maxBatchSize {
+		go db.batch.trigger()
+		db.batch = nil // later calls start a new batch
+	}
+	db.batchMutex.Unlock()
+
+	err := <-call.err
+	if err == errBatchRetry {
+		return db.ReadWrite(fn)
+	}
+	return err
+}
+
+// trigger runs the batch, the first time it's called
+func (b *batch) trigger() {
+	b.start.Do(b.run)
+}
+
+func (b *batch) run() {
+	b.db.batchMutex.Lock()
+	b.timer.Stop()
+	if b.db.batch == b {
+		b.db.batch = nil
+	}
+	b.db.batchMutex.Unlock()
+
+	errs := make([]error, len(b.calls))
+	err := b.db.ReadWrite(func(tx *Tx) error {
+		for i, call := range b.calls {
+			if !nested(tx, call.fn, &errs[i]) {
+				return errBatchRetry
+			}
+		}
+		return nil
+	})
+	for i, call := range b.calls {
+		if err != nil {
+			call.err <- errBatchRetry
+			continue
+		}
+		call.err <- errs[i]
+	}
+}
+
+// nested runs fn nested within tx, keeping the error it returns. It returns false if fn panics,
+// leaving it to panic again when it's run on its own by its caller
+func nested(tx *Tx, fn func(tx *Tx) error, err *error) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	*err = tx.Nested(fn)
+	return true
+}
@@ -0,0 +1,160 @@
+package xisdb
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func openTestBatchDB(size int, delay time.Duration) *DB {
+	db, _ := Open(&Options{
+		InMemory:           true,
+		BackgroundInterval: -1,
+		DisableExpiration:  true,
+		MaxBatchSize:       size,
+		MaxBatchDelay:      delay,
+	})
+	return db
+}
+
+// countCommits counts the write transactions committed with changes
+func countCommits(db *DB) *int {
+	var mutex sync.Mutex
+	commits := 0
+	db.OnCommit(func(changes []Change) {
+		mutex.Lock()
+		commits++
+		mutex.Unlock()
+	})
+	return &commits
+}
+
+func TestBatch(t *testing.T) {
+	fmt.Println("-- TestBatch")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db, err := Open(&Options{Filename: filename, BackgroundInterval: -1, MaxBatchSize: 50, MaxBatchDelay: time.Second})
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	commits := countCommits(db)
+	appended := db.appended
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := db.Batch(func(tx *Tx) error {
+				return tx.Set("key"+strconv.Itoa(i), strconv.Itoa(i), nil)
+			})
+			if err != nil {
+				t.Errorf("Error in batch call %d: %s", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// batches only run once they're full, so there are exactly 2 of them
+	if *commits != 2 {
+		t.Errorf("Expected 100 calls to be committed in 2 transactions, got %d", *commits)
+	}
+	if db.appended-appended != 2 {
+		t.Errorf("Expected 2 records to be written, got %d", db.appended-appended)
+	}
+	db.Close()
+
+	db = openTestFileDB(t, filename)
+	defer db.Close()
+	for i := 0; i < 100; i++ {
+		assertDBKeyValue(t, db, "key"+strconv.Itoa(i), strconv.Itoa(i), true)
+	}
+}
+
+func TestBatchDelay(t *testing.T) {
+	fmt.Println("-- TestBatchDelay")
+	db := openTestBatchDB(0, 20*time.Millisecond)
+	commits := countCommits(db)
+	start := time.Now()
+	if err := db.Batch(func(tx *Tx) error { return tx.Set("key", "value", nil) }); err != nil {
+		t.Fatalf("Error in batch call: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Expected a batch that isn't full to wait for more calls, it ran after %s", elapsed)
+	}
+	if *commits != 1 {
+		t.Errorf("Expected 1 commit, got %d", *commits)
+	}
+	assertDBKeyValue(t, db, "key", "value", true)
+}
+
+func TestBatchErrors(t *testing.T) {
+	fmt.Println("-- TestBatchErrors")
+	failure := errors.New("failure")
+	tests := []struct {
+		bad       func(tx *Tx) error
+		err       error
+		validator func(changes []Change) error
+		commits   int
+	}{
+		// only the failing call's changes are undone, everything is still committed together
+		{func(tx *Tx) error { tx.Set("bad", "value", nil); return failure }, failure, nil, 1},
+		// a failed commit runs each call again on its own
+		{func(tx *Tx) error { return tx.Set("bad", "value", nil) }, failure, func(changes []Change) error {
+			for _, change := range changes {
+				if change.Key == "bad" {
+					return failure
+				}
+			}
+			return nil
+		}, 2},
+		// a panic fails the batch, and panics again in its caller
+		{func(tx *Tx) error { tx.Set("bad", "value", nil); panic(failure) }, failure, nil, 2},
+	}
+	for i, test := range tests {
+		db := openTestBatchDB(3, time.Second)
+		if test.validator != nil {
+			db.BeforeCommit(test.validator)
+		}
+		commits := countCommits(db)
+
+		errs := make([]error, 3)
+		fns := []func(tx *Tx) error{
+			func(tx *Tx) error { return tx.Set("key1", "value", nil) },
+			test.bad,
+			func(tx *Tx) error { return tx.Set("key2", "value", nil) },
+		}
+		var wg sync.WaitGroup
+		for j, fn := range fns {
+			wg.Add(1)
+			go func(j int, fn func(tx *Tx) error) {
+				defer wg.Done()
+				defer func() {
+					if r := recover(); r != nil {
+						errs[j] = r.(error)
+					}
+				}()
+				errs[j] = db.Batch(fn)
+			}(j, fn)
+		}
+		wg.Wait()
+
+		if errs[0] != nil || errs[2] != nil {
+			t.Errorf("Test %d failed: expected the other calls to succeed, got '%v' and '%v'", i+1, errs[0], errs[2])
+		}
+		if errs[1] != test.err {
+			t.Errorf("Test %d failed: expected error '%s', got '%v'", i+1, test.err, errs[1])
+		}
+		if *commits != test.commits {
+			t.Errorf("Test %d failed: expected %d commits, got %d", i+1, test.commits, *commits)
+		}
+		assertDBKeyValue(t, db, "key1", "value", true)
+		assertDBKeyValue(t, db, "key2", "value", true)
+		if exists, _ := db.Exists("bad"); exists {
+			t.Errorf("Test %d failed: expected key 'bad' to not exist", i+1)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package xisdb
+
+import "time"
+
+// slideResolution divides a sliding bucket's DefaultTTL into the smallest step a key's expiration
+// is pushed back by, so a key that's read over and over isn't written every time
+const slideResolution = 100
+
+// BucketOptions are how a bucket treats the keys written to it. They're given when the bucket
+// is created, and can't be changed afterwards
+type BucketOptions struct {
+	// DefaultTTL is how long every key written to the bucket lives, unless it's given a TTL of
+	// its own. 0 means they never expire
+	DefaultTTL time.Duration
+	// Sliding pushes a key's expiration back to the DefaultTTL from now every time Get reads it, in
+	// steps of at least a hundredth of the DefaultTTL
+	Sliding bool
+}
+
+// validate makes sure the options can be used
+func (opts BucketOptions) validate() error {
+	if opts.DefaultTTL < 0 {
+		return ErrInvalidTTL
+	}
+	if opts.Sliding && opts.DefaultTTL == 0 {
+		return ErrSlidingWithoutTTL
+	}
+	return nil
+}
+
+// BucketWithOptions is Bucket, creating the bucket with the options if it doesn't exist. A bucket
+// that already exists with different options is an error
+func (tx *Tx) BucketWithOptions(name string, opts BucketOptions) (*Bucket, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	return tx.bucket(name, &opts)
+}
+
+// Options returns the options the bucket was created with
+func (b *Bucket) Options() BucketOptions {
+	return b.managed.options
+}
+
+// defaultExpiration is when a key written to the bucket now expires if it isn't given a TTL of
+// its own, nil if it never does
+func (b *bucket) defaultExpiration() *time.Time {
+	if b.options.DefaultTTL <= 0 {
+		return nil
+	}
+	t := time.Now().Add(b.options.DefaultTTL)
+	return &t
+}
+
+// slide pushes the key's expiration back to the bucket's DefaultTTL from now, if the bucket is
+// sliding and the key would expire enough sooner. Only write transactions can. Just the new
+// expiration is stored, and as the key's value doesn't change it isn't a change to hooks either
+func (tx *Tx) slide(b *bucket, key string) {
+	if !b.options.Sliding || !tx.write {
+		return
+	}
+	item, exists := tx.lookup(b, key)
+	if !exists || item.expiresAt() == 0 {
+		return
+	}
+	t := b.defaultExpiration()
+	if t.UnixNano()-item.expiresAt() < int64(b.options.DefaultTTL/slideResolution) {
+		return
+	}
+
+	slid := item.withExpiration(t)
+	tx.addRollback(b, key, item)
+	b.insert(slid, tx.version)
+	tx.addCommit(opExpire, b.name, slid)
+}
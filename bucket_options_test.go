@@ -0,0 +1,253 @@
+package xisdb
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// bucketOptions returns the options of the bucket by name
+func bucketOptions(db *DB, name string) BucketOptions {
+	var opts BucketOptions
+	db.ReadWrite(func(tx *Tx) error {
+		b, err := tx.Bucket(name)
+		if err != nil {
+			return err
+		}
+		opts = b.Options()
+		return nil
+	})
+	return opts
+}
+
+func TestBucketOptions(t *testing.T) {
+	fmt.Println("-- TestBucketOptions")
+	hour := BucketOptions{DefaultTTL: time.Hour}
+	tests := []struct {
+		existing *BucketOptions
+		opts     BucketOptions
+		err      error
+		expected BucketOptions
+	}{
+		{nil, hour, nil, hour},
+		{nil, BucketOptions{DefaultTTL: time.Hour, Sliding: true}, nil, BucketOptions{DefaultTTL: time.Hour, Sliding: true}},
+		{nil, BucketOptions{}, nil, BucketOptions{}},
+		{nil, BucketOptions{DefaultTTL: -time.Hour}, ErrInvalidTTL, BucketOptions{}},
+		{nil, BucketOptions{Sliding: true}, ErrSlidingWithoutTTL, BucketOptions{}},
+		{&hour, hour, nil, hour},
+		{&hour, BucketOptions{DefaultTTL: time.Minute}, ErrBucketOptionsMismatch, hour},
+		{&hour, BucketOptions{}, ErrBucketOptionsMismatch, hour},
+		{&BucketOptions{}, hour, ErrBucketOptionsMismatch, BucketOptions{}},
+	}
+	for i, test := range tests {
+		db := openTestDB()
+		if test.existing != nil {
+			db.BucketWithOptions("bucket", *test.existing)
+		}
+		if err := db.BucketWithOptions("bucket", test.opts); err != test.err {
+			t.Errorf("Test %d failed: expected error '%v', got '%v'", i+1, test.err, err)
+		}
+		// Bucket opens the bucket no matter what its options are
+		if opts := bucketOptions(db, "bucket"); opts != test.expected {
+			t.Errorf("Test %d failed: expected options %+v, got %+v", i+1, test.expected, opts)
+		}
+	}
+}
+
+func TestBucketDefaultTTL(t *testing.T) {
+	fmt.Println("-- TestBucketDefaultTTL")
+	tests := []struct {
+		op       func(b *Bucket) error
+		expected time.Duration
+	}{
+		{func(b *Bucket) error { return b.Set("key", "1") }, time.Hour},
+		{func(b *Bucket) error { return b.SetWithTTL("key", "1", time.Minute) }, time.Minute},
+		{func(b *Bucket) error { _, err := b.Incr("key"); return err }, time.Hour},
+		{func(b *Bucket) error { _, err := b.Append("key", "1"); return err }, time.Hour},
+		{func(b *Bucket) error { _, err := b.SetNX("key", "1"); return err }, time.Hour},
+		{func(b *Bucket) error { _, _, err := b.GetSet("key", "1"); return err }, time.Hour},
+		// keys keep what they were given afterwards
+		{func(b *Bucket) error {
+			b.Set("key", "1")
+			_, err := b.Persist("key")
+			return err
+		}, NoTTL},
+		{func(b *Bucket) error {
+			b.Set("key", "1")
+			b.Persist("key")
+			_, err := b.Incr("key")
+			return err
+		}, NoTTL},
+	}
+	for i, test := range tests {
+		db := openTestDB()
+		db.BucketWithOptions("bucket", BucketOptions{DefaultTTL: time.Hour})
+		err := db.ReadWrite(func(tx *Tx) error {
+			b, _ := tx.Bucket("bucket")
+			if err := test.op(b); err != nil {
+				return err
+			}
+			ttl, err := b.TTL("key")
+			if err != nil {
+				return err
+			}
+			assertTTL(t, i+1, ttl, test.expected)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("Test %d failed: unexpected error '%s'", i+1, err)
+		}
+	}
+
+	// the root bucket and buckets without a default TTL aren't affected
+	db := openTestDB()
+	db.Bucket("other")
+	db.ReadWrite(func(tx *Tx) error {
+		b, _ := tx.Bucket("other")
+		b.Set("key", "value")
+		ttl, _ := b.TTL("key")
+		assertTTL(t, 1, ttl, NoTTL)
+		tx.Set("key", "value", nil)
+		ttl, _ = tx.TTL("key")
+		assertTTL(t, 2, ttl, NoTTL)
+		return nil
+	})
+}
+
+func TestBucketSliding(t *testing.T) {
+	fmt.Println("-- TestBucketSliding")
+	tests := []struct {
+		sliding  bool
+		ttl      time.Duration
+		expected time.Duration
+	}{
+		{true, time.Minute, time.Hour},
+		{false, time.Minute, time.Minute},
+		{true, 3 * time.Hour, 3 * time.Hour},
+		{true, NoTTL, NoTTL},
+	}
+	failure := errors.New("failure")
+	for i, test := range tests {
+		db := openTestDB()
+		db.BucketWithOptions("bucket", BucketOptions{DefaultTTL: time.Hour, Sliding: test.sliding})
+		db.ReadWrite(func(tx *Tx) error {
+			b, _ := tx.Bucket("bucket")
+			if test.ttl == NoTTL {
+				b.Set("key", "value")
+				b.Persist("key")
+				return nil
+			}
+			return b.SetWithTTL("key", "value", test.ttl)
+		})
+		ttlAfter := func(fn func(b *Bucket)) time.Duration {
+			var ttl time.Duration
+			db.ReadWrite(func(tx *Tx) error {
+				b, _ := tx.Bucket("bucket")
+				fn(b)
+				ttl, _ = b.TTL("key")
+				return nil
+			})
+			return ttl
+		}
+
+		// only Get slides the expiration, and a rollback undoes it
+		assertTTL(t, i+1, ttlAfter(func(b *Bucket) { b.Exists("key") }), test.ttl)
+		db.ReadWrite(func(tx *Tx) error {
+			b, _ := tx.Bucket("bucket")
+			b.Get("key")
+			return failure
+		})
+		assertTTL(t, i+1, ttlAfter(func(b *Bucket) {}), test.ttl)
+		assertTTL(t, i+1, ttlAfter(func(b *Bucket) { b.Get("key") }), test.expected)
+	}
+}
+
+func TestBucketSlidingPersisted(t *testing.T) {
+	fmt.Println("-- TestBucketSlidingPersisted")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db := openTestFileDB(t, filename)
+	db.BucketWithOptions("sessions", BucketOptions{DefaultTTL: time.Hour, Sliding: true})
+	value := strings.Repeat("value", 100)
+	db.ReadWrite(func(tx *Tx) error {
+		b, _ := tx.Bucket("sessions")
+		return b.SetWithTTL("key", value, time.Minute)
+	})
+	var changes []Change
+	db.OnCommit(func(c []Change) {
+		changes = append(changes, c...)
+	})
+	get := func() int64 {
+		size := atomic.LoadInt64(&db.size)
+		db.ReadWrite(func(tx *Tx) error {
+			b, _ := tx.Bucket("sessions")
+			_, err := b.Get("key")
+			return err
+		})
+		return atomic.LoadInt64(&db.size) - size
+	}
+
+	// only the new expiration is stored, and a slide that's barely later isn't stored at all
+	if grown := get(); grown == 0 || grown >= int64(len(value)) {
+		t.Errorf("Expected just the expiration to be stored, the file grew by %d bytes", grown)
+	}
+	if grown := get(); grown != 0 {
+		t.Errorf("Expected nothing to be stored sliding the key again right away, the file grew by %d bytes", grown)
+	}
+	if len(changes) != 0 {
+		t.Errorf("Expected no changes from sliding a key, got %v", changes)
+	}
+	db.Close()
+
+	db = openTestFileDB(t, filename)
+	defer db.Close()
+	db.ReadWrite(func(tx *Tx) error {
+		b, _ := tx.Bucket("sessions")
+		ttl, _ := b.TTL("key")
+		assertTTL(t, 1, ttl, time.Hour)
+		if v, _ := b.Get("key"); v != value {
+			t.Errorf("Expected the key to keep its value, got '%s'", v)
+		}
+		return nil
+	})
+}
+
+func TestBucketOptionsPersisted(t *testing.T) {
+	fmt.Println("-- TestBucketOptionsPersisted")
+	sliding := BucketOptions{DefaultTTL: time.Hour, Sliding: true}
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db := openTestFileDB(t, filename)
+	db.BucketWithOptions("sessions", sliding)
+	db.Bucket("plain")
+	restorePoint := setAndGetID(db, "key", "value")
+	db.DeleteBucket("sessions")
+	db.BucketWithOptions("sessions", BucketOptions{DefaultTTL: time.Minute})
+	db.Close()
+
+	db = openTestFileDB(t, filename)
+	if opts := bucketOptions(db, "sessions"); opts != (BucketOptions{DefaultTTL: time.Minute}) {
+		t.Errorf("Expected the options to be loaded, got %+v", opts)
+	}
+	if err := db.RestoreTo(time.Unix(0, restorePoint)); err != nil {
+		t.Fatalf("Error restoring database: %s", err)
+	}
+	if opts := bucketOptions(db, "sessions"); opts != sliding {
+		t.Errorf("Expected the options to be restored, got %+v", opts)
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Error compacting database: %s", err)
+	}
+	db.Close()
+
+	db = openTestFileDB(t, filename)
+	defer db.Close()
+	if opts := bucketOptions(db, "sessions"); opts != sliding {
+		t.Errorf("Expected the options to be kept by a compaction, got %+v", opts)
+	}
+	if opts := bucketOptions(db, "plain"); opts != (BucketOptions{}) {
+		t.Errorf("Expected a bucket without options, got %+v", opts)
+	}
+}
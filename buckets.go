@@ -1,7 +1,7 @@
 package xisdb
 
 import (
-	"fmt"
+	"math"
 	"sync"
 )
 
@@ -11,24 +11,40 @@ type Bucket struct {
 	managed *bucket
 }
 
-// Get retrieves a value by its key, or errors
+// Get retrieves a value by its key, or errors. In a sliding bucket it pushes the key's expiration back
 func (b *Bucket) Get(key string) (string, error) {
-	return b.tx.get(b.managed, key)
+	if err := b.tx.check(); err != nil {
+		return "", err
+	}
+	value, err := b.tx.get(b.managed, key)
+	if err == nil {
+		b.tx.slide(b.managed, key)
+	}
+	return value, err
 }
 
 // Exists returns whether or not a key is present in the Bucket
 func (b *Bucket) Exists(key string) bool {
+	if b.tx.check() != nil {
+		return false
+	}
 	exists, _ := b.tx.exists(b.managed, key)
 	return exists
 }
 
 // Set will add or update a value
 func (b *Bucket) Set(key, value string) error {
+	if err := b.tx.check(); err != nil {
+		return err
+	}
 	return b.tx.set(b.managed, key, value, nil)
 }
 
 // Delete will delete a key from the bucket. Returns whether or not it actually was
 func (b *Bucket) Delete(key string) (bool, error) {
+	if err := b.tx.check(); err != nil {
+		return false, err
+	}
 	return b.tx.delete(b.managed, key)
 }
 
@@ -47,26 +63,54 @@ func (b *Bucket) DeleteIndex(name string) error {
 	return nil
 }
 
-// Size is how many items are in the bucket
+// Size is how many items are in the bucket, not counting any that have expired. It's 0 once the
+// transaction is done
 func (b *Bucket) Size() int {
-	return b.managed.size()
+	if b.tx.check() != nil {
+		return 0
+	}
+
+	size := 0
+	for _, item := range b.managed.items(b.tx.snapshot()) {
+		if !b.tx.expired(item) {
+			size++
+		}
+	}
+	return size
 }
 
-// bucket is a collection of key-value pairs, much like a traditional DB table
+// latest is newer than every version, so reading as of it always sees the newest version of a key
+const latest int64 = math.MaxInt64
+
+// bucket is a collection of key-value pairs, much like a traditional DB table. Every key holds a
+// chain of versions, so read transactions keep seeing the values they began with while a write
+// transaction changes them
 type bucket struct {
 	name    string
 	db      *DB
-	mutex   sync.RWMutex      // lock on a per-bucket level -- TODO: maybe not
-	data    map[string]Item   // the data itself
-	indexes map[string]*index // indexes on the data
+	mutex   sync.RWMutex        // held to change the data or indexes, and by read transactions to read them
+	data    map[string]*version // the versions of each key, newest first
+	stale   map[string]struct{} // keys with versions that may no longer be needed
+	indexes map[string]*index   // indexes on the data
+	expires *expirations        // when the newest version of each key expires
+	options BucketOptions       // how keys written to the bucket are treated
+}
+
+// version is the value a key was given in a version of the database, nil if it was deleted
+type version struct {
+	item    *Item
+	version int64
+	prev    *version
 }
 
 func newBucket(name string, db *DB) *bucket {
 	return &bucket{
 		name:    name,
 		db:      db,
-		data:    make(map[string]Item),
+		data:    make(map[string]*version),
+		stale:   make(map[string]struct{}),
 		indexes: make(map[string]*index),
+		expires: newExpirations(),
 	}
 }
 
@@ -74,63 +118,175 @@ func (b *bucket) isRoot() bool {
 	return b.db != nil && b == b.db.root()
 }
 
-func (b *bucket) get(key string) (*Item, bool) {
-	value, exists := b.data[key]
-	if !exists {
-		return nil, false
+// get returns the item as it was in version v
+func (b *bucket) get(key string, v int64) (*Item, bool) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.find(key, v)
+}
+
+// find is get for when the bucket is already locked
+func (b *bucket) find(key string, v int64) (*Item, bool) {
+	for ver := b.data[key]; ver != nil; ver = ver.prev {
+		if ver.version > v {
+			continue
+		}
+		if ver.item == nil {
+			return nil, false
+		}
+		item := *ver.item
+		return &item, true
 	}
-	return &value, exists
+	return nil, false
 }
 
-func (b *bucket) insert(item *Item) {
-	b.data[item.Key] = *item
+// changed tells you if the key has a version newer than v
+func (b *bucket) changed(key string, v int64) bool {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	head := b.data[key]
+	return head != nil && head.version > v
 }
 
-func (b *bucket) exists(key string) bool {
-	_, exists := b.data[key]
+// insert makes the item the value of its key as of version v
+func (b *bucket) insert(item *Item, v int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	value := *item
+	b.push(item.Key, &value, v)
+	b.reindex(item.Key, &value)
+	b.expires.set(item.Key, value.expiresAt())
+}
+
+func (b *bucket) exists(key string, v int64) bool {
+	_, exists := b.get(key, v)
 	return exists
 }
 
-// Delete removes a key from a bucket and returns whether or not it was removed
-func (b *bucket) delete(key string) bool {
-	item, ok := b.data[key]
-	if !ok {
-		return ok
+// Delete removes a key from a bucket as of version v and returns whether or not it was removed
+func (b *bucket) delete(key string, v int64) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.reindex(key, nil)
+	b.expires.remove(key)
+	if _, ok := b.find(key, latest); !ok {
+		return false
 	}
 
-	delete(b.data, key)
+	b.push(key, nil, v)
+	return true
+}
+
+// reindex replaces whatever each index has for the key with its new item, if it matches. The
+// item is nil when the key is deleted. The bucket must be locked
+func (b *bucket) reindex(key string, item *Item) {
 	for _, idx := range b.indexes {
-		if idx.match(&item) {
-			idx.remove(&item)
+		idx.remove(key)
+		if item != nil && idx.match(item) {
+			idx.add(item)
 		}
 	}
-	return ok
 }
 
-func (b *bucket) clear() error {
-	for _, idx := range b.indexes {
-		fmt.Printf("Idx:%s\n", idx)
-		// idx.clear()
+// push adds a version of the key, replacing the newest one if it's from the same version.
+// The bucket must be locked
+func (b *bucket) push(key string, item *Item, v int64) {
+	prev := b.data[key]
+	if prev != nil && prev.version == v {
+		prev = prev.prev
 	}
+	if prev == nil && item == nil {
+		delete(b.data, key)
+		delete(b.stale, key)
+		return
+	}
+	if prev != nil {
+		b.stale[key] = struct{}{}
+	}
+	b.data[key] = &version{item, v, prev}
+}
+
+// collect drops every version of a key older than the newest one as of version oldest, which
+// is as far back as anything is still read. Keys that were deleted by then are dropped entirely
+func (b *bucket) collect(oldest int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for key := range b.stale {
+		head := b.data[key]
+		ver := head
+		for ver != nil && ver.version > oldest {
+			ver = ver.prev
+		}
+		if ver == nil {
+			continue
+		}
+		ver.prev = nil
+		if ver != head {
+			continue
+		}
+		delete(b.stale, key)
+		if ver.item == nil {
+			delete(b.data, key)
+		}
+	}
+}
 
+// items returns every item in the bucket as it was in version v
+func (b *bucket) items(v int64) []*Item {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	items := make([]*Item, 0, len(b.data))
 	for key := range b.data {
-		delete(b.data, key)
+		if item, exists := b.find(key, v); exists {
+			items = append(items, item)
+		}
 	}
+	return items
+}
 
-	return nil
+// index returns the index by name
+func (b *bucket) index(name string) (*index, bool) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	idx, exists := b.indexes[name]
+	return idx, exists
 }
 
-func (b *bucket) size() int {
-	return len(b.data)
+// setIndex adds the index by name, or removes it if it's nil
+func (b *bucket) setIndex(name string, idx *index) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if idx == nil {
+		delete(b.indexes, name)
+		return
+	}
+	b.indexes[name] = idx
 }
 
-func (b *bucket) rollback(info *rollbackInfo) error {
+// hasIndex tells you if the bucket has an index by the name created from the definition
+func (b *bucket) hasIndex(name string, def *IndexDefinition) bool {
+	idx, exists := b.indexes[name]
+	return exists && idx.definition != nil && *idx.definition == *def
+}
+
+// size is how many items are in the bucket in version v
+func (b *bucket) size(v int64) int {
+	return len(b.items(v))
+}
+
+// rollback undoes a transaction's changes to the bucket by making everything it changed what
+// it was before, as of version v, indexes included
+func (b *bucket) rollback(info *rollbackInfo, v int64) error {
+	// indexes go back first, so restoring the items brings them back in sync too
+	for name, idx := range info.replaced {
+		b.setIndex(name, idx)
+	}
 	for key, value := range info.items {
 		if value == nil {
-			b.delete(key)
+			b.delete(key, v)
 			continue
 		}
-		b.insert(value)
+		b.insert(value, v)
 	}
 	return nil
 }
@@ -8,3 +8,20 @@ import (
 func TestBucketsRollbackAdd(t *testing.T) {
 	fmt.Println("-- TestBucketsRollback")
 }
+
+func TestBucketSize(t *testing.T) {
+	fmt.Println("-- TestBucketSize")
+	db := openTestDB()
+	var bucket *Bucket
+	db.ReadWrite(func(tx *Tx) error {
+		bucket, _ = tx.Bucket("bucket")
+		bucket.Set("key", "value")
+		if size := bucket.Size(); size != 1 {
+			t.Errorf("Expected a size of 1, got %d", size)
+		}
+		return nil
+	})
+	if size := bucket.Size(); size != 0 {
+		t.Errorf("Expected a size of 0 once the transaction is done, got %d", size)
+	}
+}
@@ -0,0 +1,164 @@
+package xisdb
+
+// ChangeOp is the kind of change a transaction made
+type ChangeOp int
+
+const (
+	// ChangeSet when a key was added or updated
+	ChangeSet ChangeOp = iota
+	// ChangeDelete when a key was deleted
+	ChangeDelete
+	// ChangeCreateBucket when a bucket was created
+	ChangeCreateBucket
+	// ChangeDeleteBucket when a bucket was deleted
+	ChangeDeleteBucket
+	// ChangeExpire when a key was deleted because it expired, with its final value as the OldValue
+	ChangeExpire
+)
+
+// Change is a single change made by a write transaction, in the order it was made. Bucket
+// changes have no key or values
+type Change struct {
+	Op       ChangeOp
+	Bucket   string
+	Key      string
+	OldValue string // the value before the change, if the key existed
+	NewValue string // the value set, empty for deletes
+	Existed  bool   // if the key existed before the change
+}
+
+// OnCommit adds a hook that's given the changes every write transaction commits, once they've been
+// persisted. Hooks run in the order transactions commit, while the database is still locked, so they
+// can read from it but mustn't write to it
+func (db *DB) OnCommit(fn func(changes []Change)) {
+	db.hooksMutex.Lock()
+	defer db.hooksMutex.Unlock()
+	db.commitHooks = append(db.commitHooks, fn)
+}
+
+// BeforeCommit adds a validator that's given the changes every write transaction is about to commit.
+// If it returns an error the transaction is rolled back instead, and the error returned from it.
+// Like OnCommit hooks, validators run while the database is locked and mustn't write to it
+func (db *DB) BeforeCommit(fn func(changes []Change) error) {
+	db.hooksMutex.Lock()
+	defer db.hooksMutex.Unlock()
+	db.validators = append(db.validators, fn)
+}
+
+// OnExpire adds a callback that's given every key in the bucket that's deleted because it expired,
+// with its final value, whether it was found by the background sweep or by a write transaction
+// reading it. Callbacks run once the deletion is committed, alongside OnCommit hooks, so they
+// mustn't write to the database either
+func (db *DB) OnExpire(bucket string, fn func(item Item)) {
+	db.hooksMutex.Lock()
+	defer db.hooksMutex.Unlock()
+	db.expireHooks[bucket] = append(db.expireHooks[bucket], fn)
+}
+
+// validate runs the validators against the changes, returning the first error
+func (db *DB) validate(changes []Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	db.hooksMutex.RLock()
+	defer db.hooksMutex.RUnlock()
+	for _, fn := range db.validators {
+		if err := fn(changes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notify runs the commit hooks with the changes
+func (db *DB) notify(changes []Change) {
+	if len(changes) == 0 {
+		return
+	}
+	db.hooksMutex.RLock()
+	defer db.hooksMutex.RUnlock()
+	for _, fn := range db.commitHooks {
+		fn(changes)
+	}
+}
+
+// expired runs the expire callbacks with the keys the transaction deleted because they expired
+func (db *DB) expired(tx *Tx) {
+	db.hooksMutex.RLock()
+	defer db.hooksMutex.RUnlock()
+	if len(db.expireHooks) == 0 {
+		return
+	}
+	for _, c := range tx.commits {
+		if !c.expired {
+			continue
+		}
+		for _, fn := range db.expireHooks[c.bucket] {
+			fn(*c.item)
+		}
+	}
+}
+
+// changes builds the transaction's changes from its commits. What each key was before the
+// transaction comes from its rollbacks, and after that from the commits before it. Once a bucket
+// is deleted its keys start out not existing. Nothing's built if there aren't any validators or
+// hooks to give them to
+func (db *DB) changes(tx *Tx) []Change {
+	db.hooksMutex.RLock()
+	hooked := len(db.validators) > 0 || len(db.commitHooks) > 0
+	db.hooksMutex.RUnlock()
+	if !hooked || len(tx.commits) == 0 {
+		return nil
+	}
+
+	type bucketKey struct{ bucket, key string }
+	current := make(map[bucketKey]*Item)
+	deleted := make(map[string]bool)
+	changes := make([]Change, 0, len(tx.commits))
+	for _, c := range tx.commits {
+		switch c.op {
+		case opCreateBucket:
+			changes = append(changes, Change{Op: ChangeCreateBucket, Bucket: c.bucket})
+		case opDeleteBucket:
+			changes = append(changes, Change{Op: ChangeDeleteBucket, Bucket: c.bucket})
+			deleted[c.bucket] = true
+			for k := range current {
+				if k.bucket == c.bucket {
+					delete(current, k)
+				}
+			}
+		case opSet, opDelete:
+			k := bucketKey{c.bucket, c.item.Key}
+			old, seen := current[k]
+			if rollback, exists := tx.rollbacks[tx.original(c.bucket)]; !seen && !deleted[c.bucket] && exists {
+				old = rollback.items[k.key]
+			}
+
+			change := Change{Op: ChangeSet, Bucket: c.bucket, Key: k.key}
+			if old != nil {
+				change.OldValue, change.Existed = old.Value, true
+			}
+			switch {
+			case c.op == opSet:
+				change.NewValue = c.item.Value
+				current[k] = c.item
+			case c.expired:
+				change.Op = ChangeExpire
+				current[k] = nil
+			default:
+				change.Op = ChangeDelete
+				current[k] = nil
+			}
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// original is the bucket by the name the transaction started with, nil if it didn't exist
+func (tx *Tx) original(name string) *bucket {
+	if b, exists := tx.rollbackBuckets[name]; exists {
+		return b
+	}
+	return tx.db.buckets[name]
+}
@@ -0,0 +1,147 @@
+package xisdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChangesOnCommit(t *testing.T) {
+	fmt.Println("-- TestChangesOnCommit")
+	db := openTestDB()
+	db.Set("key", "value")
+	db.Set("deleted", "value")
+	db.ReadWrite(func(tx *Tx) error {
+		b, _ := tx.Bucket("b2")
+		return b.Set("recreated", "value")
+	})
+
+	var got [][]Change
+	db.OnCommit(func(changes []Change) {
+		got = append(got, changes)
+	})
+	db.ReadWrite(func(tx *Tx) error {
+		tx.Set("key", "first", nil)
+		tx.Set("key", "second", nil)
+		tx.Set("added", "value", nil)
+		tx.Delete("deleted")
+		b, _ := tx.Bucket("b1")
+		b.Set("bucketkey", "value")
+		b, _ = tx.Bucket("b2")
+		b.Set("recreated", "changed")
+		tx.DeleteBucket("b2")
+		b, _ = tx.Bucket("b2")
+		b.Set("recreated", "new")
+		return nil
+	})
+	db.Read(func(tx *Tx) error { return nil })
+	db.ReadWrite(func(tx *Tx) error { return errors.New("rolled back") })
+
+	expected := []Change{
+		{Op: ChangeSet, Key: "key", OldValue: "value", NewValue: "first", Existed: true},
+		{Op: ChangeSet, Key: "key", OldValue: "first", NewValue: "second", Existed: true},
+		{Op: ChangeSet, Key: "added", NewValue: "value"},
+		{Op: ChangeDelete, Key: "deleted", OldValue: "value", Existed: true},
+		{Op: ChangeCreateBucket, Bucket: "b1"},
+		{Op: ChangeSet, Bucket: "b1", Key: "bucketkey", NewValue: "value"},
+		{Op: ChangeSet, Bucket: "b2", Key: "recreated", OldValue: "value", NewValue: "changed", Existed: true},
+		{Op: ChangeDeleteBucket, Bucket: "b2"},
+		{Op: ChangeCreateBucket, Bucket: "b2"},
+		{Op: ChangeSet, Bucket: "b2", Key: "recreated", NewValue: "new"},
+	}
+	if len(got) != 1 {
+		t.Fatalf("Expected hooks to run for the single committed write transaction, ran %d times", len(got))
+	}
+	if !reflect.DeepEqual(got[0], expected) {
+		t.Errorf("Expected changes %v, got %v", expected, got[0])
+	}
+}
+
+func TestChangesBeforeCommit(t *testing.T) {
+	fmt.Println("-- TestChangesBeforeCommit")
+	db := openTestDB()
+	errReserved := errors.New("reserved key")
+	db.BeforeCommit(func(changes []Change) error {
+		for _, change := range changes {
+			if change.Key == "reserved" {
+				return errReserved
+			}
+		}
+		return nil
+	})
+	committed := 0
+	db.OnCommit(func(changes []Change) {
+		committed++
+	})
+
+	tests := []struct {
+		key string
+		err error
+	}{
+		{"key", nil},
+		{"reserved", errReserved},
+	}
+	for i, test := range tests {
+		err := db.ReadWrite(func(tx *Tx) error {
+			tx.Set("other", test.key, nil)
+			return tx.Set(test.key, "value", nil)
+		})
+		if err != test.err {
+			t.Errorf("Test %d failed: expected error '%v', got '%v'", i+1, test.err, err)
+			continue
+		}
+		if exists, _ := db.Exists(test.key); exists != (test.err == nil) {
+			t.Errorf("Test %d failed: expected key '%s' to exist: %t, got %t", i+1, test.key, test.err == nil, exists)
+		}
+	}
+	assertDBKeyValue(t, db, "other", "key", true)
+	if committed != 1 {
+		t.Errorf("Expected hooks to only run for the transaction that was committed, ran %d times", committed)
+	}
+}
+
+func TestChangesPanics(t *testing.T) {
+	fmt.Println("-- TestChangesPanics")
+	failure := errors.New("failure")
+	set := func(tx *Tx) error { return tx.Set("key", "value", nil) }
+	tests := []struct {
+		setup     func(db *DB)
+		fn        func(tx *Tx) error
+		committed bool
+	}{
+		{func(db *DB) { db.BeforeCommit(func(changes []Change) error { panic(failure) }) }, set, false},
+		{func(db *DB) { db.OnCommit(func(changes []Change) { panic(failure) }) }, set, true},
+		{func(db *DB) {}, func(tx *Tx) error {
+			tx.Hooks(func() { panic(failure) })
+			return set(tx)
+		}, true},
+	}
+	for i, test := range tests {
+		for j, run := range []func(db *DB, fn func(tx *Tx) error) error{(*DB).ReadWrite, (*DB).Optimistic} {
+			db := openTestDB()
+			test.setup(db)
+			func() {
+				defer func() {
+					if r := recover(); r != failure {
+						t.Errorf("Test %d.%d failed: expected a panic with '%s', got '%v'", i+1, j+1, failure, r)
+					}
+				}()
+				run(db, test.fn)
+			}()
+
+			// the database is released, and the transaction only kept if it had been committed
+			if exists := db.root().exists("key", latest); exists != test.committed {
+				t.Errorf("Test %d.%d failed: expected the key to exist: %t, got %t", i+1, j+1, test.committed, exists)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			err := db.ReadWriteContext(ctx, func(tx *Tx) error { return nil })
+			cancel()
+			if err != nil {
+				t.Errorf("Test %d.%d failed: expected the database to be released, got '%s'", i+1, j+1, err)
+			}
+		}
+	}
+}
@@ -54,7 +54,7 @@ func main() {
 			io.WriteString(out, "Timed out\n")
 			return
 		case r := <-ctx.Results:
-			io.WriteString(out, fmt.Sprintf("Received:[%s]\n", r))
+			io.WriteString(out, fmt.Sprintf("Received:[%v]\n", r))
 		}
 		t.Stop()
 	}
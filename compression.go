@@ -0,0 +1,115 @@
+package xisdb
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+// Compression is how records are compressed before they're stored
+type Compression byte
+
+const (
+	// CompressionNone stores records as they are
+	CompressionNone Compression = iota
+	// CompressionFlate compresses records with DEFLATE
+	CompressionFlate
+	// CompressionGzip compresses records with gzip, DEFLATE with a header and checksum of its own
+	CompressionGzip
+)
+
+// recordCompressed is the kind of a compressed record: how it was compressed, followed by the
+// compressed record. Every record is tagged with how it was compressed, so one written with any
+// setting can be read back whatever the database is set to now. Records that don't get any
+// smaller are stored as they are
+const recordCompressed byte = 0xc1
+
+var (
+	flateWriters = sync.Pool{New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	}}
+	gzipWriters = sync.Pool{New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}}
+)
+
+func (c Compression) valid() bool {
+	return c <= CompressionGzip
+}
+
+// compress compresses the record, unless that doesn't make it any smaller
+func (c Compression) compress(record []byte) []byte {
+	if c == CompressionNone {
+		return record
+	}
+
+	buf := bytes.NewBuffer([]byte{recordCompressed, byte(c)})
+	switch c {
+	case CompressionFlate:
+		w := flateWriters.Get().(*flate.Writer)
+		w.Reset(buf)
+		w.Write(record)
+		w.Close()
+		flateWriters.Put(w)
+	case CompressionGzip:
+		w := gzipWriters.Get().(*gzip.Writer)
+		w.Reset(buf)
+		w.Write(record)
+		w.Close()
+		gzipWriters.Put(w)
+	}
+
+	if buf.Len() >= len(record) {
+		return record
+	}
+	return buf.Bytes()
+}
+
+// decompress decompresses the record if it's compressed
+func decompress(record []byte) ([]byte, error) {
+	if len(record) == 0 || record[0] != recordCompressed {
+		return record, nil
+	}
+	if len(record) < 2 {
+		return nil, ErrIncorrectDatabaseFileFormat
+	}
+
+	var r io.ReadCloser
+	compressed := bytes.NewReader(record[2:])
+	switch Compression(record[1]) {
+	case CompressionFlate:
+		r = flate.NewReader(compressed)
+	case CompressionGzip:
+		gr, err := gzip.NewReader(compressed)
+		if err != nil {
+			return nil, ErrIncorrectDatabaseFileFormat
+		}
+		r = gr
+	default:
+		return nil, ErrIncorrectDatabaseFileFormat
+	}
+	defer r.Close()
+
+	decompressed, err := io.ReadAll(r)
+	if err != nil {
+		return nil, ErrIncorrectDatabaseFileFormat
+	}
+	return decompressed, nil
+}
+
+// pack prepares an encoded record to be stored, compressing and then encrypting it
+func (db *DB) pack(record []byte) []byte {
+	return db.cipher.seal(db.compression.compress(record))
+}
+
+// unpack reverses pack for a stored record, decrypting it with the cipher and then decompressing it
+func unpack(c *recordCipher, record []byte) ([]byte, error) {
+	record, err := c.open(record)
+	if err != nil {
+		return nil, err
+	}
+	return decompress(record)
+}
@@ -0,0 +1,103 @@
+package xisdb
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCompressionRecords(t *testing.T) {
+	fmt.Println("-- TestCompressionRecords")
+	value := strings.Repeat(`{"name":"value","tags":["a","b","c"]},`, 20)
+	tests := []struct {
+		compression, reopen Compression
+		key                 []byte
+	}{
+		{CompressionNone, CompressionFlate, nil},
+		{CompressionFlate, CompressionGzip, nil},
+		{CompressionGzip, CompressionNone, nil},
+		{CompressionFlate, CompressionFlate, testKey},
+	}
+	sizes := map[Compression]int64{}
+	for i, test := range tests {
+		filename := filepath.Join(t.TempDir(), "test.data")
+		opts := &Options{Filename: filename, Compression: test.compression, EncryptionKey: test.key, BackgroundInterval: -1}
+		db, err := Open(opts)
+		if err != nil {
+			t.Fatalf("Test %d failed: error opening database: %s", i+1, err)
+		}
+		for j := 0; j < 10; j++ {
+			db.Set(strconv.Itoa(j), value)
+		}
+		db.Close()
+		if test.key == nil {
+			sizes[test.compression] = fileSize(t, filename)
+		}
+
+		data, _ := os.ReadFile(filename)
+		if _, compression, _ := parseFileHeader(data); compression != test.compression {
+			t.Errorf("Test %d failed: expected the header to record compression %d, got %d", i+1, test.compression, compression)
+		}
+
+		// written with one setting and opened with another, then compacted with it
+		opts.Compression = test.reopen
+		db, err = Open(opts)
+		if err != nil {
+			t.Fatalf("Test %d failed: error reopening database: %s", i+1, err)
+		}
+		db.Set("10", value)
+		assertDBKeyValue(t, db, "0", value, true)
+		if err := db.Compact(); err != nil {
+			t.Errorf("Test %d failed: error compacting: %s", i+1, err)
+		}
+		db.Close()
+
+		db, err = Open(opts)
+		if err != nil {
+			t.Fatalf("Test %d failed: error reopening compacted database: %s", i+1, err)
+		}
+		assertDBKeyValue(t, db, "10", value, true)
+		db.Close()
+	}
+
+	if sizes[CompressionFlate] >= sizes[CompressionNone] || sizes[CompressionGzip] >= sizes[CompressionNone] {
+		t.Errorf("Expected compression to shrink the database file, got sizes %v", sizes)
+	}
+}
+
+func TestCompressionVersion1File(t *testing.T) {
+	fmt.Println("-- TestCompressionVersion1File")
+	e := &encoder{}
+	e.record(recordCommit, 1, []*commit{{op: opSet, item: &Item{Key: "key", Value: "value"}}})
+	filename := filepath.Join(t.TempDir(), "test.data")
+	os.WriteFile(filename, append([]byte{'x', 'i', 's', 'd', 'b', 1}, frameRecord(e.bytes())...), 0666)
+
+	db, err := Open(&Options{Filename: filename, Compression: CompressionGzip, BackgroundInterval: -1})
+	if err != nil {
+		t.Fatalf("Error opening version 1 database file: %s", err)
+	}
+	defer db.Close()
+	assertDBKeyValue(t, db, "key", "value", true)
+}
+
+func TestCompressionBackup(t *testing.T) {
+	fmt.Println("-- TestCompressionBackup")
+	db, _ := Open(&Options{InMemory: true, Compression: CompressionGzip, BackgroundInterval: -1})
+	db.Set("key", strings.Repeat("value", 100))
+	var backup bytes.Buffer
+	db.Backup(&backup)
+
+	restored := openTestDB()
+	if err := restored.Restore(bytes.NewReader(backup.Bytes())); err != nil {
+		t.Fatalf("Error restoring compressed backup: %s", err)
+	}
+	assertDBKeyValue(t, restored, "key", strings.Repeat("value", 100), true)
+
+	if _, err := Open(&Options{InMemory: true, Compression: CompressionGzip + 1}); err != ErrInvalidCompression {
+		t.Errorf("Expected error '%s' with an invalid compression, got '%v'", ErrInvalidCompression, err)
+	}
+}
@@ -1,8 +1,9 @@
 package xisdb
 
 import (
-	"os"
+	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,14 +15,46 @@ const (
 // Do not create an instance of this struct directly as you may introduce undesired
 // side-effects through improper initialization.
 type DB struct {
-	mutex      sync.RWMutex       // sync.RWMutex enables multiple read clients but only a single writer
-	persistent bool               // if false, do not persist to disk
-	file       *os.File           // where to save the data
-	fileErrors bool               // if loading a file should return an error
-	readOnly   bool               // if this database is read-only
-	bginterval int                // how often to perform background cleanup
-	expires    bool               // if expiring keys are enabled
-	buckets    map[string]*bucket // buckets
+	writer      chan struct{}      // holds a token while the single write transaction, a snapshot or closing has the database locked
+	storage     Storage            // where to save the data, nil if it's only kept in memory
+	cipher      *recordCipher      // encrypts records before they're stored, nil if they aren't
+	compression Compression        // how records are compressed before they're stored
+	sync        SyncMode           // when to flush the storage to stable storage
+	fileErrors  bool               // if loading a file should return an error
+	readOnly    bool               // if this database is read-only
+	bginterval  int                // how often to perform background cleanup
+	expires     bool               // if expiring keys are enabled
+	buckets     map[string]*bucket // buckets
+	rootBucket  *bucket            // the root bucket, which is never deleted
+	appended    int64              // how many records have been appended to the storage since it was opened
+	size        int64              // bytes of records in the storage
+	lastID      int64              // id of the last committed write transaction
+	stop        chan struct{}      // closed when the database is closed
+	recovery    RecoveryReport     // what happened replaying the storage
+	until       int64              // the last transaction id to replay from the storage, latest for all of them
+
+	version      int64         // the last committed version of the data, what read transactions begin reading
+	collected    int64         // the oldest version being read when old versions were last collected
+	readersMutex sync.Mutex    // held while read transactions begin and end
+	readers      map[int64]int // how many read transactions are reading each version
+
+	bucketsMutex sync.RWMutex // held to add or remove buckets, and by read transactions to find them
+
+	hooksMutex  sync.RWMutex            // held while commit hooks, validators and expire callbacks are added or run
+	commitHooks []func([]Change)        // run with the changes of every committed write transaction
+	validators  []func([]Change) error  // run with the changes of every write transaction before it's committed
+	expireHooks map[string][]func(Item) // run with every key in each bucket that's deleted because it expired
+
+	batchMutex    sync.Mutex    // held while calls are added to a batch
+	batch         *batch        // the batch calls to Batch are added to, nil until the next call
+	maxBatchSize  int           // the most calls in a single batch
+	maxBatchDelay time.Duration // how long a batch waits for more calls before it's run
+
+	compactMutex   sync.Mutex // only a single compaction at a time
+	compacting     int32      // set while a background compaction is running
+	compacted      int64      // bytes of records in the snapshot the storage was last compacted to
+	compactRatio   float64    // how many times larger than compacted the storage grows before compacting
+	compactMinSize int64      // the storage is never compacted automatically below this size
 }
 
 // Item is an item in the database, includes both the key and value of the object
@@ -34,51 +67,169 @@ type itemMetadata struct {
 	expiration *time.Time
 }
 
-// Open creates a new database
+// Open creates a new database. Once it's open, Recovery reports what happened replaying its storage
 func Open(opts *Options) (*DB, error) {
+	return open(opts, latest)
+}
+
+// open creates a new database, replaying its storage only up to transaction id until
+func open(opts *Options, until int64) (*DB, error) {
 	db := &DB{
 		readOnly:   opts.ReadOnly,
-		persistent: !opts.InMemory,
+		fileErrors: !opts.SkipDatabaseFileErrors,
+		sync:       opts.Sync,
 		expires:    !opts.DisableExpiration,
 		bginterval: opts.BackgroundInterval,
 		buckets:    make(map[string]*bucket),
+		readers:    make(map[int64]int),
+		writer:     make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		until:      until,
+
+		expireHooks: make(map[string][]func(Item)),
+
+		compactRatio:   opts.CompactionRatio,
+		compactMinSize: opts.CompactionMinSize,
+
+		maxBatchSize:  opts.MaxBatchSize,
+		maxBatchDelay: opts.MaxBatchDelay,
+	}
+	if db.compactRatio == 0 {
+		db.compactRatio = defaultCompactionRatio
+	}
+	if db.compactMinSize == 0 {
+		db.compactMinSize = defaultCompactionMinSize
+	}
+	if db.maxBatchSize <= 0 {
+		db.maxBatchSize = defaultMaxBatchSize
+	}
+	if db.maxBatchDelay <= 0 {
+		db.maxBatchDelay = defaultMaxBatchDelay
+	}
+	db.rootBucket = newBucket("", db)
+	db.buckets[""] = db.rootBucket // adding the rootBucket
+
+	var err error
+	if db.cipher, err = newRecordCipher(opts.EncryptionKey); err != nil {
+		return nil, err
+	}
+	if db.compression = opts.Compression; !db.compression.valid() {
+		return nil, ErrInvalidCompression
+	}
+	if db.compactRatio > 0 && db.compactRatio < 1 {
+		return nil, ErrInvalidCompactionRatio
 	}
-	db.buckets[""] = newBucket("", db) // adding the rootBucket
+	if err := db.openStorage(opts); err != nil {
+		return nil, err
+	}
+
 	db.start()
 	return db, nil
 }
 
 // Close shuts down the database instance
 func (db *DB) Close() error {
-	return nil
+	db.compactMutex.Lock()
+	defer db.compactMutex.Unlock()
+	db.lock()
+	defer db.unlock()
+
+	if db.isClosed() {
+		return ErrDatabaseClosed
+	}
+	close(db.stop)
+
+	if db.storage == nil {
+		return nil
+	}
+	return db.storage.Close()
+}
+
+func (db *DB) isClosed() bool {
+	select {
+	case <-db.stop:
+		return true
+	default:
+		return false
+	}
 }
 
 // Read performs a read-only transaction against the database
 func (db *DB) Read(fn func(tx *Tx) error) error {
-	return db.execute(fn, false)
+	return db.execute(context.Background(), fn, false)
 }
 
 // ReadWrite performs a write-allowed transaction against the database
 func (db *DB) ReadWrite(fn func(tx *Tx) error) error {
+	return db.ReadWriteContext(context.Background(), fn)
+}
+
+// ReadContext performs a read-only transaction against the database with a context, which fn
+// can get from tx.Context(). Once the context is done, the transaction can't be used any more
+// and its error is returned
+func (db *DB) ReadContext(ctx context.Context, fn func(tx *Tx) error) error {
+	return db.execute(ctx, fn, false)
+}
+
+// ReadWriteContext performs a write-allowed transaction against the database with a context,
+// which fn can get from tx.Context(). If the context is done before the database can be locked
+// its error is returned without running fn. If it's done while fn is running, the transaction
+// can't be used any more and is rolled back, even if fn doesn't return an error
+func (db *DB) ReadWriteContext(ctx context.Context, fn func(tx *Tx) error) error {
 	if db.readOnly {
 		return ErrDatabaseReadOnly
 	}
 
-	return db.execute(fn, true)
+	return db.execute(ctx, fn, true)
+}
+
+// Begin starts a transaction that stays open until it's ended with Commit or Rollback. Read
+// transactions see the database as it was when they began, and never wait for, or hold up, a
+// write transaction. Only a single write transaction can be open at a time. Always end a
+// transaction, or the database stays locked or keeps every version the transaction can see
+func (db *DB) Begin(writable bool) (*Tx, error) {
+	if writable && db.readOnly {
+		return nil, ErrDatabaseReadOnly
+	}
+
+	tx, _ := db.begin(context.Background(), writable)
+	if db.isClosed() {
+		db.done(tx)
+		tx.close()
+		return nil, ErrDatabaseClosed
+	}
+	return tx, nil
 }
 
 // addBucket will create a new bucket with the name, otherwise returns the existing
 // returns the bucket and whether or not it was created
-func (db *DB) addBucket(name string) (*bucket, bool) {
+func (db *DB) addBucket(name string, opts BucketOptions) (*bucket, bool) {
 	if bucket, exists := db.buckets[name]; exists {
 		return bucket, false
 	}
 
 	bucket := newBucket(name, db)
-	db.buckets[name] = bucket
+	bucket.options = opts
+	db.setBucket(name, bucket)
 	return bucket, true
 }
 
+// setBucket adds the bucket by name, replacing any that's there
+func (db *DB) setBucket(name string, b *bucket) {
+	db.bucketsMutex.Lock()
+	defer db.bucketsMutex.Unlock()
+	db.buckets[name] = b
+}
+
+// bucket finds the bucket by name. Read transactions use it, as buckets may be added or removed
+// by a write transaction while they read
+func (db *DB) bucket(name string) (*bucket, bool) {
+	db.bucketsMutex.RLock()
+	defer db.bucketsMutex.RUnlock()
+	b, exists := db.buckets[name]
+	return b, exists
+}
+
 // deleteBucket removes a bucket from the database, returns if the bucket exists
 // retruns an error if an attempt to remove the root bucket is made
 func (db *DB) deleteBucket(name string) (bool, error) {
@@ -91,12 +242,14 @@ func (db *DB) deleteBucket(name string) (bool, error) {
 		return true, ErrCannotDeleteRootBucket
 	}
 
+	db.bucketsMutex.Lock()
 	delete(db.buckets, name)
+	db.bucketsMutex.Unlock()
 	return exists, nil
 }
 
 func (db *DB) root() *bucket {
-	return db.buckets[""]
+	return db.rootBucket
 }
 
 func (db *DB) start() {
@@ -113,133 +266,233 @@ func (db *DB) start() {
 	}
 }
 
-// background performs background tasks, like cleanp of TTL keys
-// TTL cleanup happens in a transaction, so pubsub and persistence and everything else
+// background performs background tasks, like cleanp of TTL keys and flushing the storage
+// TTL cleanup happens in transactions, so pubsub and persistence and everything else
 // takes place with the expirations as well
 func (db *DB) background() error {
 	ticker := time.NewTicker(time.Millisecond * time.Duration(db.bginterval))
 	defer ticker.Stop()
-	for range ticker.C {
-		if !db.expires {
+	for {
+		select {
+		case <-db.stop:
+			return nil
+		case <-ticker.C:
+		}
+		if db.sync == SyncInterval {
+			db.Sync()
+		}
+		if !db.expires || db.readOnly {
 			continue
 		}
 
-		err := db.ReadWrite(func(tx *Tx) error {
-			buckets, err := tx.Buckets()
-			if err != nil {
-				return err
-			}
-			// TODO: potentially make expiration non-transactional
-			now := time.Now().UnixNano()
-			for _, bucket := range buckets {
-				for _, item := range bucket.managed.data {
-					if item.metadata != nil && item.metadata.expiration != nil {
-						if now > item.metadata.expiration.Unix() {
-							_, err := tx.delete(bucket.managed, item.Key)
-							if err != nil {
-								return err
-							}
-						}
-					}
-				}
-			}
+		// a sweep that fails, say because a validator rejected it, is tried again on the next tick
+		if _, err := db.expire(time.Now()); err == ErrDatabaseClosed {
 			return nil
-		})
+		}
+	}
+}
 
-		if err != nil {
-			return err
+func (db *DB) execute(ctx context.Context, fn func(tx *Tx) error, write bool) error {
+	txn, err := db.begin(ctx, write)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// a panicking fn still ends its transaction, so the database isn't left locked
+		if p := recover(); p != nil {
+			txn.managed = false
+			txn.Rollback()
+			panic(p)
 		}
+	}()
+	txn.managed = true
+	err = firstNonNil(fn(txn), ctx.Err())
+	txn.managed = false
+
+	if write && err != nil {
+		return firstNonNil(txn.Rollback(), err)
 	}
+	// TODO: make this a slice?
+	return firstNonNil(txn.Commit(), err)
+}
 
-	return nil
+// begin starts a new transaction with the context. Read transactions are registered as reading
+// the last committed version, write transactions lock the database, unless the context is done
+// first, and are given an id greater than every one committed before them, so ids follow the
+// order transactions were committed in
+func (db *DB) begin(ctx context.Context, write bool) (*Tx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !write {
+		db.readersMutex.Lock()
+		defer db.readersMutex.Unlock()
+		tx := NewTransaction(false, db)
+		tx.ctx = ctx
+		db.readers[tx.version]++
+		return tx, nil
+	}
+
+	if err := db.lockContext(ctx); err != nil {
+		return nil, err
+	}
+	tx := NewTransaction(true, db)
+	tx.ctx = ctx
+	if tx.id <= db.lastID {
+		tx.id = db.lastID + 1
+	}
+	return tx, nil
 }
 
-func (db *DB) execute(fn func(tx *Tx) error, write bool) error {
-	txn := NewTransaction(write, db)
-	db.lock(write) // TODO: defer db.unlock(write) ?
-	defer txn.close()
-	defer db.unlock(txn.write)
+// done releases the database from the transaction: unlocking it for a write transaction, or
+// letting go of the version a read transaction was reading
+func (db *DB) done(tx *Tx) {
+	if tx.write {
+		db.unlock()
+		return
+	}
 
-	err := fn(txn)
-	if !write {
-		// TODO: make this a slice?
-		return firstNonNil(db.commit(txn), err)
+	db.readersMutex.Lock()
+	defer db.readersMutex.Unlock()
+	if db.readers[tx.version]--; db.readers[tx.version] <= 0 {
+		delete(db.readers, tx.version)
 	}
+}
 
-	if err != nil {
-		rollbackErr := db.rollback(txn)
-		if rollbackErr != nil {
-			err = rollbackErr
+// oldest is the oldest version of the data that's still being read
+func (db *DB) oldest() int64 {
+	db.readersMutex.Lock()
+	defer db.readersMutex.Unlock()
+	oldest := atomic.LoadInt64(&db.version)
+	for v := range db.readers {
+		if v < oldest {
+			oldest = v
 		}
-		return err
 	}
+	return oldest
+}
 
-	err = db.commit(txn)
-	if err != nil {
-		err = db.rollback(txn) // no idea how to handle an error here...
+// collect drops every version of the data that can't be read anymore. It only does anything
+// once the oldest version being read has moved on since it last ran. The database must be locked
+func (db *DB) collect() {
+	oldest := db.oldest()
+	if oldest <= db.collected {
+		return
 	}
-	return err
+
+	for _, b := range db.buckets {
+		b.collect(oldest)
+	}
+	db.collected = oldest
 }
 
 func (db *DB) commit(tx *Tx) error {
+	if tx.write {
+		changes := db.changes(tx)
+		if err := db.validate(changes); err != nil {
+			return err
+		}
+		if err := db.persist(tx); err != nil {
+			return err
+		}
+		db.lastID = tx.id
+		atomic.StoreInt64(&db.version, tx.version)
+		db.collect()
+		if db.shouldCompact() {
+			db.compactInBackground()
+		}
+		db.notify(changes)
+		db.expired(tx)
+	}
 	db.hooks(tx)
-	// persist to disk
 	// pub-sub
 	return nil
 }
 
+// commitWrite commits the write transaction, rolling it back if it can't be, and releases the
+// database either way. That includes a validator or hook panicking, which rolls the transaction
+// back too unless it had already been committed, before panicking again
+func (db *DB) commitWrite(tx *Tx) error {
+	defer func() {
+		if p := recover(); p != nil {
+			if atomic.LoadInt64(&db.version) == tx.version {
+				db.done(tx)
+			} else {
+				db.rollback(tx)
+			}
+			panic(p)
+		}
+	}()
+
+	if err := db.commit(tx); err != nil {
+		return firstNonNil(db.rollback(tx), err)
+	}
+	db.done(tx)
+	return nil
+}
+
 func (db *DB) hooks(tx *Tx) {
 	for _, fn := range tx.hooks {
 		fn()
 	}
 }
 
+// rollback undoes the transaction's changes. Everything it changed is put back as it was in the
+// next version, which is then committed in place of the transaction's
 func (db *DB) rollback(tx *Tx) error {
-	defer db.unlock(tx.write)
+	defer db.done(tx)
 	if !tx.write {
 		return ErrCannotRollbackReadTransaction
 	}
 
-	for name, bucket := range tx.rollbackBuckets {
+	v := db.version + 1
+	err := db.undo(tx.rollbackBuckets, tx.rollbacks, v)
+	atomic.StoreInt64(&db.version, v)
+	return err
+}
+
+// undo puts every bucket, item and index in the undo records back as they were, as of version v
+func (db *DB) undo(rollbackBuckets map[string]*bucket, rollbacks map[*bucket]*rollbackInfo, v int64) error {
+	for name, bucket := range rollbackBuckets {
 		if bucket == nil {
 			db.deleteBucket(name)
 			continue
 		}
 
-		db.buckets[name] = bucket
+		db.setBucket(name, bucket)
 	}
 
-	for bucket, rollback := range tx.rollbacks {
-		b, exists := db.buckets[bucket]
-		if exists {
-			err := b.rollback(rollback)
-			if err != nil {
-				return err
-			}
+	// rollbacks are kept by bucket, not name, since a bucket deleted and created again under the
+	// same name is a different one, and only what's back in the database needs undoing
+	for b, rollback := range rollbacks {
+		if db.buckets[b.name] != b {
+			continue
+		}
+		if err := b.rollback(rollback, v); err != nil {
+			return err
 		}
 	}
-
 	return nil
 }
 
-// lock makes the database locked (uses RWMutex, so multiple readers available)
-func (db *DB) lock(write bool) {
-	if write {
-		db.mutex.Lock()
-		return
-	}
-
-	db.mutex.RLock()
+// lock makes the database locked for writing. Read transactions never lock it
+func (db *DB) lock() {
+	db.writer <- struct{}{}
 }
 
-// unlock makes the database accessible again
-func (db *DB) unlock(write bool) {
-	if write {
-		db.mutex.Unlock()
-		return
+// lockContext locks the database for writing, unless the context is done first
+func (db *DB) lockContext(ctx context.Context) error {
+	select {
+	case db.writer <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
 
-	db.mutex.RUnlock()
+// unlock makes the database accessible again
+func (db *DB) unlock() {
+	<-db.writer
 }
 
 func firstNonNil(errs ...error) error {
@@ -1,6 +1,7 @@
 package xisdb
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -11,8 +12,8 @@ func TestDBRollbackItemAdd(t *testing.T) {
 	db := openTestDB()
 	tx := NewTransaction(true, db)
 	assertDBKeyValue(t, db, "key", "value", false)
-	tx.addRollback("", "key", &Item{"key", "value", nil})
-	db.lock(true)
+	tx.addRollback(db.root(), "key", &Item{"key", "value", nil})
+	db.lock()
 	db.rollback(tx)
 	assertDBKeyValue(t, db, "key", "value", false)
 }
@@ -23,10 +24,10 @@ func TestDBRollbackItemUpdate(t *testing.T) {
 	tx := NewTransaction(true, db)
 	db.Set("key", "value")
 	assertDBKeyValue(t, db, "key", "value", true)
-	tx.addRollback("", "key", &Item{"key", "value", nil})
+	tx.addRollback(db.root(), "key", &Item{"key", "value", nil})
 	db.Set("key", "value2")
 	assertDBKeyValue(t, db, "key", "value2", true)
-	db.lock(true)
+	db.lock()
 	db.rollback(tx)
 	assertDBKeyValue(t, db, "key", "value", true)
 }
@@ -37,8 +38,8 @@ func TestDBRollbackItemDelete(t *testing.T) {
 	tx := NewTransaction(true, db)
 	db.Set("key", "value")
 	assertDBKeyValue(t, db, "key", "value", true)
-	tx.addRollback("", "key", nil)
-	db.lock(true)
+	tx.addRollback(db.root(), "key", nil)
+	db.lock()
 	db.rollback(tx)
 	assertDBKeyValue(t, db, "key", "value", false)
 }
@@ -51,7 +52,7 @@ func TestDBRollbackBucketAdd(t *testing.T) {
 	db.Bucket("b1")
 	assertBucketExists(t, db, "b1", true)
 	tx.addRollbackBucket("b1", nil) // didn't exist before
-	db.lock(true)
+	db.lock()
 	err := db.rollback(tx)
 	if err != nil {
 		t.Errorf("Got an error rolling back: %s", err)
@@ -68,7 +69,7 @@ func TestDBRollbackBucketDelete(t *testing.T) {
 	assertBucketExists(t, db, "b1", true)
 	b := db.buckets["b1"]
 	tx.addRollbackBucket("b1", b)
-	db.lock(true)
+	db.lock()
 	err := db.rollback(tx)
 	if err != nil {
 		t.Errorf("Got an error rolling back: %s", err)
@@ -97,7 +98,7 @@ func TestDBRollbackBucketMultipleOperations(t *testing.T) {
 	if len(tx.rollbackBuckets) != 1 {
 		t.Errorf("Expected 1 item in bucket rollback log, got %d", len(tx.rollbackBuckets))
 	}
-	db.lock(true)
+	db.lock()
 	err := db.rollback(tx)
 	if err != nil {
 		t.Errorf("Got an error rolling back: %s", err)
@@ -108,7 +109,7 @@ func TestDBRollbackBucketMultipleOperations(t *testing.T) {
 func TestDBAddRootBucket(t *testing.T) {
 	fmt.Println("-- TestDBAddRootBucket")
 	db := openTestDB()
-	b, created := db.addBucket("")
+	b, created := db.addBucket("", BucketOptions{})
 	if created {
 		t.Errorf("Expected bucket '' to not be created, it was")
 	}
@@ -137,7 +138,6 @@ func TestDBCommitHooks(t *testing.T) {
 	}
 	tx := NewTransaction(false, db)
 	tx.Hooks(f)
-	db.lock(false)
 	db.commit(tx)
 	if i != 1 {
 		t.Errorf("Expected function to run, it did not")
@@ -174,6 +174,132 @@ func TestDBExpiration(t *testing.T) {
 	}
 }
 
+// TestDBSnapshotIsolation -- tests that a read transaction sees the database as it began, without blocking writers
+func TestDBSnapshotIsolation(t *testing.T) {
+	fmt.Println("-- TestDBSnapshotIsolation")
+	db := openTestDB()
+	db.Set("key", "value")
+	db.Set("deleted", "value")
+
+	tx, _ := db.Begin(false)
+	done := make(chan error)
+	go func() {
+		done <- db.ReadWrite(func(tx *Tx) error {
+			tx.Set("key", "changed", nil)
+			tx.Set("added", "value", nil)
+			_, err := tx.Delete("deleted")
+			return err
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Error writing while a read transaction is open: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected writing to not wait for the read transaction")
+	}
+
+	tests := []struct {
+		key, value string
+		exists     bool
+	}{
+		{"key", "value", true},
+		{"deleted", "value", true},
+		{"added", "", false},
+	}
+	for i, test := range tests {
+		value, err := tx.Get(test.key)
+		if test.exists && (err != nil || value != test.value) {
+			t.Errorf("Test %d failed: expected '%s' in the read transaction, got '%s', %v", i+1, test.value, value, err)
+		}
+		if !test.exists && err != ErrKeyNotFound {
+			t.Errorf("Test %d failed: expected error '%s' in the read transaction, got '%v'", i+1, ErrKeyNotFound, err)
+		}
+	}
+	tx.Commit()
+
+	assertDBKeyValue(t, db, "key", "changed", true)
+	assertDBKeyValue(t, db, "added", "value", true)
+	if exists, _ := db.Exists("deleted"); exists {
+		t.Errorf("Expected key 'deleted' to not exist after the read transaction ended")
+	}
+}
+
+// TestDBCollectVersions -- tests that old versions are only kept while a read transaction can see them
+func TestDBCollectVersions(t *testing.T) {
+	fmt.Println("-- TestDBCollectVersions")
+	db := openTestDB()
+	db.Set("key", "value")
+	db.Set("deleted", "value")
+
+	tx, _ := db.Begin(false)
+	db.Set("key", "value2")
+	db.Set("key", "value3")
+	db.Delete("deleted")
+	if n := versions(db.root(), "key"); n != 3 {
+		t.Errorf("Expected every version since the one being read to be kept, got %d versions", n)
+	}
+	if n := versions(db.root(), "deleted"); n != 2 {
+		t.Errorf("Expected a deleted key to be kept while it's being read, got %d versions", n)
+	}
+	tx.Rollback()
+
+	db.Set("other", "value")
+	if n := versions(db.root(), "key"); n != 1 {
+		t.Errorf("Expected only the newest version to be kept once nothing reads the others, got %d", n)
+	}
+	if _, exists := db.root().data["deleted"]; exists {
+		t.Errorf("Expected a deleted key to be dropped once nothing reads it")
+	}
+}
+
+// TestDBContext -- tests that transactions with a context give up once it's done
+func TestDBContext(t *testing.T) {
+	fmt.Println("-- TestDBContext")
+	db := openTestDB()
+	db.Set("key", "value")
+
+	writer, _ := db.Begin(true)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	ran := false
+	err := db.ReadWriteContext(ctx, func(tx *Tx) error {
+		ran = true
+		return nil
+	})
+	if err != context.DeadlineExceeded || ran {
+		t.Errorf("Expected error '%s' without running, waiting for the lock, got '%v', ran: %t", context.DeadlineExceeded, err, ran)
+	}
+	type key struct{}
+	ctx = context.WithValue(context.Background(), key{}, "request")
+	err = db.ReadContext(ctx, func(tx *Tx) error {
+		if tx.Context().Value(key{}) != "request" {
+			t.Errorf("Expected the transaction to have the context it was started with")
+		}
+		_, err := tx.Get("key")
+		return err
+	})
+	if err != nil {
+		t.Errorf("Expected to read while the database is locked, got '%s'", err)
+	}
+	writer.Rollback()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	err = db.ReadWriteContext(ctx, func(tx *Tx) error {
+		tx.Set("key", "changed", nil)
+		cancel()
+		if err := tx.Set("other", "value", nil); err != context.Canceled {
+			t.Errorf("Expected error '%s' using a cancelled transaction, got '%v'", context.Canceled, err)
+		}
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("Expected error '%s' from a cancelled transaction, got '%v'", context.Canceled, err)
+	}
+	assertDBKeyValue(t, db, "key", "value", true)
+}
+
 func TestDBBackground(t *testing.T) {
 	fmt.Println("-- TestDBBackground")
 }
@@ -204,3 +330,11 @@ func assertBucketExists(t *testing.T, db *DB, bucket string, exists bool) {
 		t.Errorf("Expected bucket to exist: %t, got %t", exists, !exists)
 	}
 }
+
+func versions(b *bucket, key string) int {
+	n := 0
+	for v := b.data[key]; v != nil; v = v.prev {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,227 @@
+package xisdb
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// opType is the kind of change a commit makes to the database
+type opType byte
+
+const (
+	opSet opType = iota + 1
+	opDelete
+	opCreateBucket
+	opDeleteBucket
+	opCreateIndex
+	opDeleteIndex
+	opBucketOptions
+	opExpire
+)
+
+// The kinds of records written to the database file
+const (
+	recordCommit      byte = iota + 1 // a committed write transaction
+	recordSnapshot                    // a block of a snapshot
+	recordSnapshotEnd                 // marks the end of a complete snapshot
+)
+
+// commit is a single change made by a transaction, kept in the order it was made
+type commit struct {
+	op      opType
+	bucket  string
+	item    *Item            // the item set, just the key for deletes, or the key and its expiration. nil for bucket and index operations
+	index   *IndexDefinition // the index created, or just the name for deletes. nil otherwise
+	expired bool             // if a delete is of a key that expired, when item is its final value
+	options *BucketOptions   // the options a bucket was created with. nil for everything else
+}
+
+// encoder builds the binary representation of records written to the database file
+type encoder struct {
+	buf     []byte
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (e *encoder) bytes() []byte {
+	return e.buf
+}
+
+func (e *encoder) putByte(b byte) {
+	e.buf = append(e.buf, b)
+}
+
+func (e *encoder) putUvarint(v uint64) {
+	n := binary.PutUvarint(e.scratch[:], v)
+	e.buf = append(e.buf, e.scratch[:n]...)
+}
+
+func (e *encoder) putVarint(v int64) {
+	n := binary.PutVarint(e.scratch[:], v)
+	e.buf = append(e.buf, e.scratch[:n]...)
+}
+
+func (e *encoder) putString(s string) {
+	e.putUvarint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// record writes a record of the given kind: the transaction id and every commit
+func (e *encoder) record(kind byte, id int64, commits []*commit) {
+	e.putByte(kind)
+	e.putVarint(id)
+	e.putUvarint(uint64(len(commits)))
+	for _, c := range commits {
+		e.commit(c)
+	}
+}
+
+func (e *encoder) commit(c *commit) {
+	e.putByte(byte(c.op))
+	e.putString(c.bucket)
+	switch c.op {
+	case opSet:
+		e.putString(c.item.Key)
+		e.putString(c.item.Value)
+		e.putVarint(c.item.expiresAt())
+	case opDelete:
+		e.putString(c.item.Key)
+	case opCreateIndex:
+		e.putString(c.index.Name)
+		e.putUvarint(uint64(c.index.Type))
+		e.putString(c.index.Matcher.Name)
+		e.putString(c.index.Matcher.Arg)
+		e.putString(c.index.Comparator)
+	case opDeleteIndex:
+		e.putString(c.index.Name)
+	case opBucketOptions:
+		var sliding byte
+		if c.options.Sliding {
+			sliding = 1
+		}
+		e.putVarint(int64(c.options.DefaultTTL))
+		e.putByte(sliding)
+	case opExpire:
+		e.putString(c.item.Key)
+		e.putVarint(c.item.expiresAt())
+	}
+}
+
+// decoder reads back what an encoder has written. The first error encountered
+// is kept, and every read after it is a no-op returning the zero value
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = ErrIncorrectDatabaseFileFormat
+	}
+	d.buf = nil
+}
+
+func (d *decoder) getByte() byte {
+	if len(d.buf) < 1 {
+		d.fail()
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+func (d *decoder) getUvarint() uint64 {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) getVarint() int64 {
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) getString() string {
+	l := d.getUvarint()
+	if uint64(len(d.buf)) < l {
+		d.fail()
+		return ""
+	}
+	s := string(d.buf[:l])
+	d.buf = d.buf[l:]
+	return s
+}
+
+// record reads back the kind of record, its transaction id and all of its commits
+func (d *decoder) record() (byte, int64, []*commit) {
+	kind := d.getByte()
+	switch kind {
+	case recordCommit, recordSnapshot, recordSnapshotEnd:
+	default:
+		d.fail()
+	}
+	id := d.getVarint()
+	n := d.getUvarint()
+	var commits []*commit
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		commits = append(commits, d.commit())
+	}
+	return kind, id, commits
+}
+
+func (d *decoder) commit() *commit {
+	c := &commit{
+		op:     opType(d.getByte()),
+		bucket: d.getString(),
+	}
+	switch c.op {
+	case opSet:
+		c.item = &Item{Key: d.getString(), Value: d.getString()}
+		c.item.metadata = newItemMetadata(d.getVarint())
+	case opDelete:
+		c.item = &Item{Key: d.getString()}
+	case opCreateIndex:
+		c.index = &IndexDefinition{Name: d.getString(), Type: IndexType(d.getUvarint())}
+		c.index.Matcher.Name = d.getString()
+		c.index.Matcher.Arg = d.getString()
+		c.index.Comparator = d.getString()
+	case opDeleteIndex:
+		c.index = &IndexDefinition{Name: d.getString()}
+	case opBucketOptions:
+		c.options = &BucketOptions{DefaultTTL: time.Duration(d.getVarint()), Sliding: d.getByte() == 1}
+	case opExpire:
+		c.item = &Item{Key: d.getString()}
+		c.item.metadata = newItemMetadata(d.getVarint())
+	case opCreateBucket, opDeleteBucket:
+	default:
+		d.fail()
+	}
+	return c
+}
+
+// expiresAt is the expiration of the item in unix nanoseconds, 0 if it never expires
+func (i *Item) expiresAt() int64 {
+	if i.metadata == nil || i.metadata.expiration == nil {
+		return 0
+	}
+	return i.metadata.expiration.UnixNano()
+}
+
+// newItemMetadata creates the metadata for an item expiring at the unix nanosecond timestamp, if any
+func newItemMetadata(expires int64) *itemMetadata {
+	md := &itemMetadata{}
+	if expires != 0 {
+		t := time.Unix(0, expires)
+		md.expiration = &t
+	}
+	return md
+}
@@ -0,0 +1,67 @@
+package xisdb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestEncodingCommitsRoundTrip(t *testing.T) {
+	fmt.Println("-- TestEncodingCommitsRoundTrip")
+	expires := time.Now().Add(time.Minute)
+	commits := []*commit{
+		{op: opCreateBucket, bucket: "bucket"},
+		{op: opSet, bucket: "bucket", item: &Item{"key", "value", &itemMetadata{&expires}}},
+		{op: opSet, item: &Item{"key", "", nil}},
+		{op: opDelete, item: &Item{Key: "key"}},
+		{op: opExpire, bucket: "bucket", item: &Item{Key: "key", metadata: &itemMetadata{&expires}}},
+		{op: opDeleteBucket, bucket: "bucket"},
+	}
+	e := &encoder{}
+	e.record(recordCommit, 42, commits)
+
+	d := &decoder{buf: e.bytes()}
+	kind, id, decoded := d.record()
+	if d.err != nil {
+		t.Fatalf("Unexpected error decoding commits: %s", d.err)
+	}
+	if kind != recordCommit {
+		t.Errorf("Expected record kind %d, got %d", recordCommit, kind)
+	}
+	if id != 42 {
+		t.Errorf("Expected transaction id 42, got %d", id)
+	}
+	if len(decoded) != len(commits) {
+		t.Fatalf("Expected %d commits, got %d", len(commits), len(decoded))
+	}
+	for i, c := range commits {
+		got := decoded[i]
+		if got.op != c.op || got.bucket != c.bucket {
+			t.Errorf("Commit %d: expected op %d on bucket '%s', got op %d on '%s'", i+1, c.op, c.bucket, got.op, got.bucket)
+			continue
+		}
+		if c.item == nil {
+			continue
+		}
+		if got.item.Key != c.item.Key || got.item.Value != c.item.Value {
+			t.Errorf("Commit %d: expected %s=%s, got %s=%s", i+1, c.item.Key, c.item.Value, got.item.Key, got.item.Value)
+		}
+		if (c.op == opSet || c.op == opExpire) && got.item.expiresAt() != c.item.expiresAt() {
+			t.Errorf("Commit %d: expected expiration %d, got %d", i+1, c.item.expiresAt(), got.item.expiresAt())
+		}
+	}
+}
+
+func TestEncodingTruncated(t *testing.T) {
+	fmt.Println("-- TestEncodingTruncated")
+	e := &encoder{}
+	e.record(recordCommit, 1, []*commit{{op: opSet, item: &Item{"key", "value", nil}}})
+	record := e.bytes()
+	for i := 0; i < len(record); i++ {
+		d := &decoder{buf: record[:i]}
+		d.record()
+		if d.err != ErrIncorrectDatabaseFileFormat {
+			t.Errorf("Expected error decoding %d of %d bytes, got '%s'", i, len(record), d.err)
+		}
+	}
+}
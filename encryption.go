@@ -0,0 +1,108 @@
+package xisdb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"sync/atomic"
+)
+
+// recordEncrypted is the kind of a record sealed with AES-GCM: a random nonce followed by
+// the encrypted record. Once a key is set every record must be encrypted, so none can be
+// slipped in without it. A database that's already been written is encrypted by opening it
+// without a key and rotating to one
+const recordEncrypted byte = 0xe1
+
+// recordCipher encrypts records before they're stored and decrypts them when they're read
+// back. A nil recordCipher leaves records as they are
+type recordCipher struct {
+	aead cipher.AEAD
+}
+
+// newRecordCipher creates the cipher for an AES-128, AES-192 or AES-256 key, nil if there's no key
+func newRecordCipher(key []byte) (*recordCipher, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, ErrInvalidEncryptionKey
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &recordCipher{aead}, nil
+}
+
+// seal encrypts the record
+func (c *recordCipher) seal(record []byte) []byte {
+	if c == nil {
+		return record
+	}
+
+	size := c.aead.NonceSize()
+	sealed := make([]byte, 1+size, 1+size+len(record)+c.aead.Overhead())
+	sealed[0] = recordEncrypted
+	rand.Read(sealed[1:]) // never fails
+	return c.aead.Seal(sealed, sealed[1:], record, nil)
+}
+
+// open decrypts the record if it's encrypted. Records are checked for corruption before
+// they're decrypted, so one that can't be is always down to the key
+func (c *recordCipher) open(record []byte) ([]byte, error) {
+	encrypted := len(record) > 0 && record[0] == recordEncrypted
+	switch {
+	case !encrypted && c == nil:
+		return record, nil
+	case !encrypted:
+		return nil, ErrDatabaseNotEncrypted
+	case c == nil:
+		return nil, ErrDatabaseEncrypted
+	}
+
+	size := c.aead.NonceSize()
+	if len(record) < 1+size {
+		return nil, ErrIncorrectDatabaseFileFormat
+	}
+	opened, err := c.aead.Open(nil, record[1:1+size], record[1+size:], nil)
+	if err != nil {
+		return nil, ErrEncryptionKey
+	}
+	return opened, nil
+}
+
+// RotateKey changes the key the database is encrypted with, re-encrypting everything by compacting
+// it with the new key. Writers are held up until it's done, so nothing is left encrypted with the
+// old one. A nil key removes encryption altogether. Like any compaction it discards history, so the
+// database can't be restored to a time before the key was rotated
+func (db *DB) RotateKey(key []byte) error {
+	if db.readOnly {
+		return ErrDatabaseReadOnly
+	}
+	c, err := newRecordCipher(key)
+	if err != nil {
+		return err
+	}
+
+	db.compactMutex.Lock()
+	defer db.compactMutex.Unlock()
+	db.lock()
+	defer db.unlock()
+	if db.isClosed() {
+		return ErrDatabaseClosed
+	}
+
+	previous := db.cipher
+	db.cipher = c
+	if db.storage == nil {
+		return nil
+	}
+
+	if err := db.compact(db.snapshot(), db.appended, atomic.LoadInt64(&db.size)); err != nil {
+		db.cipher = previous
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package xisdb
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	testKey      = []byte("0123456789abcdef0123456789abcdef")
+	testOtherKey = []byte("fedcba9876543210")
+)
+
+func openEncryptedTestDB(filename string, key []byte) (*DB, error) {
+	return Open(&Options{Filename: filename, EncryptionKey: key, BackgroundInterval: -1})
+}
+
+func TestEncryptionOpen(t *testing.T) {
+	fmt.Println("-- TestEncryptionOpen")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db, err := openEncryptedTestDB(filename, testKey)
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	db.Set("key", "secretvalue")
+	db.Bucket("secretbucket")
+	db.Close()
+
+	data, _ := os.ReadFile(filename)
+	if bytes.Contains(data, []byte("secretvalue")) || bytes.Contains(data, []byte("secretbucket")) {
+		t.Errorf("Expected the database file to be encrypted")
+	}
+
+	tests := []struct {
+		key []byte
+		err error
+	}{
+		{testKey, nil},
+		{testOtherKey, ErrEncryptionKey},
+		{nil, ErrDatabaseEncrypted},
+		{[]byte("short"), ErrInvalidEncryptionKey},
+	}
+	for i, test := range tests {
+		db, err := openEncryptedTestDB(filename, test.key)
+		if err != test.err {
+			t.Errorf("Test %d failed: expected error '%v', got '%v'", i+1, test.err, err)
+		}
+		if err == nil {
+			assertDBKeyValue(t, db, "key", "secretvalue", true)
+			assertBucketExists(t, db, "secretbucket", true)
+			db.Close()
+		}
+	}
+
+	// a wrong key isn't mistaken for corruption to skip over
+	_, err = Open(&Options{Filename: filename, EncryptionKey: testOtherKey, SkipDatabaseFileErrors: true, BackgroundInterval: -1})
+	if err != ErrEncryptionKey {
+		t.Errorf("Expected error '%s' skipping file errors, got '%v'", ErrEncryptionKey, err)
+	}
+}
+
+func TestEncryptionRotateKey(t *testing.T) {
+	fmt.Println("-- TestEncryptionRotateKey")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db := openTestFileDB(t, filename)
+	db.Set("key1", "value1")
+	db.Close()
+
+	// an unencrypted database can't be opened with a key, it's encrypted by rotating to one
+	if _, err := openEncryptedTestDB(filename, testKey); err != ErrDatabaseNotEncrypted {
+		t.Errorf("Expected error '%s' opening an unencrypted database with a key, got '%v'", ErrDatabaseNotEncrypted, err)
+	}
+	db = openTestFileDB(t, filename)
+	db.Set("key2", "value2")
+	if err := db.RotateKey(testKey); err != nil {
+		t.Fatalf("Error rotating key: %s", err)
+	}
+	if err := db.RotateKey(testOtherKey); err != nil {
+		t.Fatalf("Error rotating key: %s", err)
+	}
+	db.Set("key3", "value3")
+	db.Close()
+
+	if _, err := openEncryptedTestDB(filename, testKey); err != ErrEncryptionKey {
+		t.Errorf("Expected error '%s' opening with the old key, got '%v'", ErrEncryptionKey, err)
+	}
+	db, err := openEncryptedTestDB(filename, testOtherKey)
+	if err != nil {
+		t.Fatalf("Error opening database with the new key: %s", err)
+	}
+	assertDBKeyValue(t, db, "key1", "value1", true)
+	assertDBKeyValue(t, db, "key2", "value2", true)
+	assertDBKeyValue(t, db, "key3", "value3", true)
+
+	if err := db.RotateKey([]byte("short")); err != ErrInvalidEncryptionKey {
+		t.Errorf("Expected error '%s' rotating to an invalid key, got '%v'", ErrInvalidEncryptionKey, err)
+	}
+	if err := db.RotateKey(nil); err != nil {
+		t.Fatalf("Error removing encryption: %s", err)
+	}
+	db.Close()
+
+	db = openTestFileDB(t, filename)
+	defer db.Close()
+	assertDBKeyValue(t, db, "key3", "value3", true)
+}
+
+func TestEncryptionBackup(t *testing.T) {
+	fmt.Println("-- TestEncryptionBackup")
+	db, err := Open(&Options{InMemory: true, EncryptionKey: testKey, BackgroundInterval: -1})
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	db.Set("key", "secretvalue")
+	var backup bytes.Buffer
+	db.Backup(&backup)
+	if bytes.Contains(backup.Bytes(), []byte("secretvalue")) {
+		t.Errorf("Expected the backup to be encrypted")
+	}
+
+	if err := openTestDB().Restore(bytes.NewReader(backup.Bytes())); err != ErrDatabaseEncrypted {
+		t.Errorf("Expected error '%s' restoring without a key, got '%v'", ErrDatabaseEncrypted, err)
+	}
+	restored, _ := Open(&Options{InMemory: true, EncryptionKey: testKey, BackgroundInterval: -1})
+	if err := restored.Restore(bytes.NewReader(backup.Bytes())); err != nil {
+		t.Fatalf("Error restoring backup: %s", err)
+	}
+	assertDBKeyValue(t, restored, "key", "secretvalue", true)
+
+	// and a backup that isn't encrypted can't be restored with a key
+	backup.Reset()
+	openTestDB().Backup(&backup)
+	if err := restored.Restore(&backup); err != ErrDatabaseNotEncrypted {
+		t.Errorf("Expected error '%s' restoring an unencrypted backup, got '%v'", ErrDatabaseNotEncrypted, err)
+	}
+}
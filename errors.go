@@ -30,6 +30,69 @@ var (
 	// ErrCannotDeleteRootBucket when an attempt to delete the root bucket is made
 	ErrCannotDeleteRootBucket = errors.New("Cannot delete root bucket")
 
+	// ErrBucketDoesNotExist when a bucket is read from that doesn't exist
+	ErrBucketDoesNotExist = errors.New("Bucket doesn't exist")
+
+	// ErrDatabaseClosed when the database has been closed and cannot be used any longer
+	ErrDatabaseClosed = errors.New("Database is closed")
+
+	// ErrDatabaseLocked when the database file is locked by another process
+	ErrDatabaseLocked = errors.New("Database file is locked by another process")
+
+	// ErrDatabaseNotPersistent when a file operation is attempted on an in-memory database
+	ErrDatabaseNotPersistent = errors.New("Database isn't persisted to a file")
+
+	// ErrRestorePointUnavailable when restoring to a time before the database file was last compacted
+	ErrRestorePointUnavailable = errors.New("Database file has been compacted past the restore point")
+
+	// ErrInvalidEncryptionKey when the encryption key isn't a valid AES key size
+	ErrInvalidEncryptionKey = errors.New("Encryption key must be 16, 24 or 32 bytes")
+
+	// ErrEncryptionKey when the database, or a backup, was encrypted with a different key
+	ErrEncryptionKey = errors.New("Database is encrypted with a different key")
+
+	// ErrDatabaseEncrypted when the database, or a backup, is encrypted but no key is given
+	ErrDatabaseEncrypted = errors.New("Database is encrypted, an encryption key is required")
+
+	// ErrDatabaseNotEncrypted when an encryption key is given but the database, or a backup, isn't encrypted with it
+	ErrDatabaseNotEncrypted = errors.New("Database isn't encrypted, open it without a key and rotate to one")
+
+	// ErrInvalidCompression when the compression setting isn't one of the Compression constants
+	ErrInvalidCompression = errors.New("Compression is invalid")
+
+	// ErrInvalidCompactionRatio when the compaction ratio is between 0 and 1, so a compaction would trigger another
+	ErrInvalidCompactionRatio = errors.New("Compaction ratio must be at least 1")
+
+	// ErrTxClosed when a transaction is used after it's been committed or rolled back
+	ErrTxClosed = errors.New("Transaction is closed")
+
+	// ErrTxManaged when a transaction run by Read or ReadWrite is committed or rolled back by hand
+	ErrTxManaged = errors.New("Transaction is committed or rolled back by Read or ReadWrite")
+
+	// ErrSavepointDoesNotExist when rolling back to or releasing a savepoint that was never made, or was released
+	ErrSavepointDoesNotExist = errors.New("Savepoint doesn't exist")
+
+	// ErrConflict when an optimistic transaction is committed after what it read or wrote was changed
+	ErrConflict = errors.New("Transaction conflicts with one committed since it began")
+
+	// ErrNotInteger when incrementing a value that isn't an integer
+	ErrNotInteger = errors.New("Value is not an integer")
+
+	// ErrNotNumber when incrementing a value by a float that isn't a number
+	ErrNotNumber = errors.New("Value is not a number")
+
+	// ErrNumberOverflow when incrementing a value would overflow it
+	ErrNumberOverflow = errors.New("Increment would overflow the value")
+
+	// ErrInvalidTTL when setting a key with a TTL that isn't positive
+	ErrInvalidTTL = errors.New("TTL must be positive")
+
+	// ErrSlidingWithoutTTL when a bucket's options are sliding without a default TTL to slide by
+	ErrSlidingWithoutTTL = errors.New("Sliding expiration requires a default TTL")
+
+	// ErrBucketOptionsMismatch when a bucket that already exists is asked for with different options
+	ErrBucketOptionsMismatch = errors.New("Bucket already exists with different options")
+
 	// ErrCannotRollbackReadTransaction when you try and roll back a read-only transaction
 	ErrCannotRollbackReadTransaction = errors.New("Read-only transactions cannot be rolled back")
 )
@@ -0,0 +1,143 @@
+package xisdb
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expirationChunkSize is the most keys expired in a single transaction, so the database is never
+// locked for long no matter how many keys are due
+const expirationChunkSize = 1000
+
+// expiration is when a key expires, in unix nanoseconds
+type expiration struct {
+	key   string
+	at    int64
+	index int // where it is in the heap
+}
+
+// expirationHeap orders expirations soonest first
+type expirationHeap []*expiration
+
+func (h expirationHeap) Len() int           { return len(h) }
+func (h expirationHeap) Less(i, j int) bool { return h[i].at < h[j].at }
+
+func (h expirationHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expirationHeap) Push(x interface{}) {
+	e := x.(*expiration)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *expirationHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
+
+// expirations tracks when each key in a bucket expires, so the keys that are due are found
+// without looking at any others
+type expirations struct {
+	heap expirationHeap
+	keys map[string]*expiration
+}
+
+func newExpirations() *expirations {
+	return &expirations{keys: make(map[string]*expiration)}
+}
+
+// set makes the key expire at the unix nanosecond timestamp, never if it's 0
+func (e *expirations) set(key string, at int64) {
+	exp, exists := e.keys[key]
+	switch {
+	case at == 0 && exists:
+		e.remove(key)
+	case at == 0:
+	case exists:
+		exp.at = at
+		heap.Fix(&e.heap, exp.index)
+	default:
+		exp = &expiration{key: key, at: at}
+		e.keys[key] = exp
+		heap.Push(&e.heap, exp)
+	}
+}
+
+// remove stops tracking the key
+func (e *expirations) remove(key string) {
+	if exp, exists := e.keys[key]; exists {
+		heap.Remove(&e.heap, exp.index)
+		delete(e.keys, key)
+	}
+}
+
+// next is the key that expires soonest
+func (e *expirations) next() (*expiration, bool) {
+	if len(e.heap) == 0 {
+		return nil, false
+	}
+	return e.heap[0], true
+}
+
+// len is how many keys expire
+func (e *expirations) len() int {
+	return len(e.heap)
+}
+
+// expired tells you if the item has expired by now
+func (i *Item) expired(now time.Time) bool {
+	at := i.expiresAt()
+	return at != 0 && at <= now.UnixNano()
+}
+
+// expired returns the key in the bucket that expired the longest ago, if any have by now
+func (b *bucket) expired(now time.Time) (string, bool) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	exp, exists := b.expires.next()
+	if !exists || exp.at > now.UnixNano() {
+		return "", false
+	}
+	return exp.key, true
+}
+
+// expire deletes every key that's expired by now, a chunk of them per transaction, and returns
+// how many it deleted
+func (db *DB) expire(now time.Time) (int, error) {
+	total := 0
+	for {
+		n := 0
+		err := db.ReadWrite(func(tx *Tx) error {
+			buckets, err := tx.Buckets()
+			if err != nil {
+				return err
+			}
+			for _, b := range buckets {
+				for n < expirationChunkSize {
+					key, due := b.managed.expired(now)
+					if !due {
+						break
+					}
+					item, _ := tx.find(b.managed, key)
+					tx.remove(b.managed, key, item, true)
+					n++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < expirationChunkSize {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package xisdb
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alexsward/xisdb/indexes"
+	"github.com/alexsward/xisdb/ql"
+)
+
+func TestExpirationHeap(t *testing.T) {
+	fmt.Println("-- TestExpirationHeap")
+	tests := []struct {
+		set      map[string]int64
+		remove   []string
+		expected []string
+	}{
+		{map[string]int64{}, nil, []string{}},
+		{map[string]int64{"a": 3, "b": 1, "c": 2}, nil, []string{"b", "c", "a"}},
+		{map[string]int64{"a": 3, "b": 1, "c": 2}, []string{"b"}, []string{"c", "a"}},
+		{map[string]int64{"a": 3, "b": 1, "c": 0}, nil, []string{"b", "a"}},
+		{map[string]int64{"a": 3, "b": 1, "c": 2}, []string{"a", "b", "c", "d"}, []string{}},
+	}
+	for i, test := range tests {
+		e := newExpirations()
+		for key := range test.set {
+			e.set(key, 100)
+		}
+		// setting them again moves them in the heap, 0 takes them out of it
+		for key, at := range test.set {
+			e.set(key, at)
+		}
+		for _, key := range test.remove {
+			e.remove(key)
+		}
+		if e.len() != len(test.expected) {
+			t.Errorf("Test %d failed: expected %d expirations, got %d", i+1, len(test.expected), e.len())
+			continue
+		}
+		for _, key := range test.expected {
+			exp, _ := e.next()
+			if exp.key != key {
+				t.Errorf("Test %d failed: expected key '%s' to expire next, got '%s'", i+1, key, exp.key)
+			}
+			e.remove(exp.key)
+		}
+		if _, exists := e.next(); exists {
+			t.Errorf("Test %d failed: expected no more expirations", i+1)
+		}
+	}
+}
+
+func TestExpire(t *testing.T) {
+	fmt.Println("-- TestExpire")
+	tests := []struct {
+		expired, bucketExpired, future int
+		commits                        int
+	}{
+		{0, 0, 10, 0},
+		{10, 0, 10, 1},
+		{expirationChunkSize, 0, 10, 1},
+		{expirationChunkSize - 10, 10, 10, 1},
+		{expirationChunkSize, 1, 10, 2},
+		{2*expirationChunkSize + 1, 500, 10, 3},
+	}
+	for i, test := range tests {
+		db := openTestDB()
+		commits := countCommits(db)
+		past := time.Now().Add(-time.Minute).UnixNano()
+		db.ReadWrite(func(tx *Tx) error {
+			b, _ := tx.Bucket("bucket")
+			for j := 0; j < test.expired; j++ {
+				tx.insert(tx.db.root(), &Item{"expired" + strconv.Itoa(j), "value", newItemMetadata(past)})
+			}
+			for j := 0; j < test.bucketExpired; j++ {
+				tx.insert(b.managed, &Item{"expired" + strconv.Itoa(j), "value", newItemMetadata(past)})
+			}
+			for j := 0; j < test.future; j++ {
+				tx.SetWithTTL("future"+strconv.Itoa(j), "value", time.Hour)
+			}
+			return nil
+		})
+		*commits = 0
+
+		n, err := db.expire(time.Now())
+		if err != nil {
+			t.Errorf("Test %d failed: unexpected error '%s'", i+1, err)
+			continue
+		}
+		if n != test.expired+test.bucketExpired {
+			t.Errorf("Test %d failed: expected %d keys to expire, got %d", i+1, test.expired+test.bucketExpired, n)
+		}
+		if *commits != test.commits {
+			t.Errorf("Test %d failed: expected %d commits, got %d", i+1, test.commits, *commits)
+		}
+		if size := db.root().size(latest); size != test.future {
+			t.Errorf("Test %d failed: expected %d keys left, got %d", i+1, test.future, size)
+		}
+		if size := db.buckets["bucket"].size(latest); size != 0 {
+			t.Errorf("Test %d failed: expected the bucket to be empty, got %d keys", i+1, size)
+		}
+		if expires := db.root().expires.len(); expires != test.future {
+			t.Errorf("Test %d failed: expected %d keys left to expire, got %d", i+1, test.future, expires)
+		}
+	}
+}
+
+func TestExpirationTracking(t *testing.T) {
+	fmt.Println("-- TestExpirationTracking")
+	failure := errors.New("failure")
+	tests := []struct {
+		op       func(tx *Tx) error
+		expected []string
+	}{
+		{func(tx *Tx) error { return tx.SetWithTTL("key3", "value", time.Minute) }, []string{"key3", "key1", "key2"}},
+		{func(tx *Tx) error { return tx.SetWithTTL("key1", "value", 3*time.Hour) }, []string{"key2", "key1"}},
+		{func(tx *Tx) error { return tx.Set("key1", "value", nil) }, []string{"key2"}},
+		{func(tx *Tx) error { _, err := tx.Delete("key2"); return err }, []string{"key1"}},
+		{func(tx *Tx) error { _, err := tx.Persist("key2"); return err }, []string{"key1"}},
+		{func(tx *Tx) error { _, err := tx.Expire("key2", -time.Hour); return err }, []string{"key1"}},
+		{func(tx *Tx) error { _, err := tx.Expire("key2", time.Second); return err }, []string{"key2", "key1"}},
+	}
+	for i, test := range tests {
+		filename := filepath.Join(t.TempDir(), "test.data")
+		db := openTestFileDB(t, filename)
+		db.SetWithTTL("key1", "value", time.Hour)
+		db.SetWithTTL("key2", "value", 2*time.Hour)
+
+		// a rollback puts the expirations back the way they were
+		db.ReadWrite(func(tx *Tx) error {
+			test.op(tx)
+			return failure
+		})
+		assertExpirations(t, i+1, db, []string{"key1", "key2"})
+
+		if err := db.ReadWrite(test.op); err != nil {
+			t.Errorf("Test %d failed: unexpected error '%s'", i+1, err)
+		}
+		assertExpirations(t, i+1, db, test.expected)
+
+		// and they're the same once loaded again
+		db.Close()
+		db = openTestFileDB(t, filename)
+		assertExpirations(t, i+1, db, test.expected)
+		db.Close()
+	}
+}
+
+// assertExpirations checks the keys in the root bucket expire in the expected order
+func assertExpirations(t *testing.T, test int, db *DB, expected []string) {
+	e := newExpirations()
+	for key, exp := range db.root().expires.keys {
+		e.set(key, exp.at)
+	}
+	if e.len() != len(expected) {
+		t.Errorf("Test %d failed: expected %d keys to expire, got %d", test, len(expected), e.len())
+		return
+	}
+	for _, key := range expected {
+		exp, _ := e.next()
+		if exp.key != key {
+			t.Errorf("Test %d failed: expected key '%s' to expire next, got '%s'", test, key, exp.key)
+		}
+		e.remove(exp.key)
+	}
+}
+
+func TestExpirationBackground(t *testing.T) {
+	fmt.Println("-- TestExpirationBackground")
+	db, _ := Open(&Options{InMemory: true, BackgroundInterval: 5})
+	defer db.Close()
+	db.SetWithTTL("expires", "value", 10*time.Millisecond)
+	db.SetWithTTL("stays", "value", time.Hour)
+	db.Set("persists", "value")
+
+	deadline := time.Now().Add(time.Second)
+	for db.root().exists("expires", latest) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if db.root().exists("expires", latest) {
+		t.Errorf("Expected key 'expires' to have been expired in the background")
+	}
+	assertDBKeyValue(t, db, "stays", "value", true)
+	assertDBKeyValue(t, db, "persists", "value", true)
+
+	// a sweep that fails doesn't stop the ones after it
+	db.SetWithTTL("vetoed", "value", 10*time.Millisecond)
+	var vetoes int32
+	db.BeforeCommit(func(changes []Change) error {
+		if atomic.AddInt32(&vetoes, 1) <= 3 {
+			return errors.New("veto")
+		}
+		return nil
+	})
+	deadline = time.Now().Add(time.Second)
+	for db.root().exists("vetoed", latest) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if db.root().exists("vetoed", latest) {
+		t.Errorf("Expected key 'vetoed' to have been expired once the sweeps stopped failing")
+	}
+
+	// a read-only database has nothing to sweep with, it only hides the expired keys
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db = openTestFileDB(t, filename)
+	db.SetWithTTL("expires", "value", 10*time.Millisecond)
+	db.Close()
+	db, err := Open(&Options{Filename: filename, ReadOnly: true, BackgroundInterval: 5})
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	defer db.Close()
+	time.Sleep(50 * time.Millisecond)
+	if !db.root().exists("expires", latest) {
+		t.Errorf("Expected key 'expires' to not have been swept from a read-only database")
+	}
+	if exists, _ := db.Exists("expires"); exists {
+		t.Errorf("Expected key 'expires' to be hidden once it's expired")
+	}
+}
+
+func TestLazyExpiration(t *testing.T) {
+	fmt.Println("-- TestLazyExpiration")
+	tests := []struct {
+		read     func(t *testing.T, tx *Tx)
+		deletes  bool
+		disabled bool
+	}{
+		{func(t *testing.T, tx *Tx) {
+			if _, err := tx.Get("key"); err != ErrKeyNotFound {
+				t.Errorf("Expected error '%s', got '%v'", ErrKeyNotFound, err)
+			}
+		}, true, false},
+		{func(t *testing.T, tx *Tx) {
+			if exists, _ := tx.Exists("key"); exists {
+				t.Errorf("Expected the expired key to not exist")
+			}
+		}, true, false},
+		{func(t *testing.T, tx *Tx) {
+			if _, err := tx.TTL("key"); err != ErrKeyNotFound {
+				t.Errorf("Expected error '%s', got '%v'", ErrKeyNotFound, err)
+			}
+		}, true, false},
+		{func(t *testing.T, tx *Tx) {
+			items, _ := tx.iterate(tx.db.root(), "keys", 0)
+			if err := assertIteration(t, items, []string{"other"}); err != nil {
+				t.Error(err)
+			}
+		}, true, false},
+		{func(t *testing.T, tx *Tx) {
+			items, _ := query(tx, ql.NewSelectStatement())
+			if err := assertIteration(t, items, []string{"other"}); err != nil {
+				t.Error(err)
+			}
+		}, true, false},
+		{func(t *testing.T, tx *Tx) {
+			if size := (&Bucket{tx, tx.db.root()}).Size(); size != 1 {
+				t.Errorf("Expected a size of 1, got %d", size)
+			}
+		}, false, false},
+		// with expiration disabled the key is still there
+		{func(t *testing.T, tx *Tx) {
+			if value, err := tx.Get("key"); err != nil || value != "value" {
+				t.Errorf("Expected 'value', nil, got '%s', %v", value, err)
+			}
+		}, false, true},
+	}
+	for i, test := range tests {
+		for _, write := range []bool{false, true} {
+			db, _ := Open(&Options{InMemory: true, BackgroundInterval: -1, DisableExpiration: test.disabled})
+			db.CreateIndex(IndexDefinition{Name: "keys", Matcher: indexes.Wildcard()})
+			past := time.Now().Add(-time.Minute).UnixNano()
+			db.ReadWrite(func(tx *Tx) error {
+				tx.insert(tx.db.root(), &Item{"key", "value", newItemMetadata(past)})
+				return tx.Set("other", "value", nil)
+			})
+
+			fn := func(tx *Tx) error {
+				test.read(t, tx)
+				return nil
+			}
+			if write {
+				db.ReadWrite(fn)
+			} else {
+				db.Read(fn)
+			}
+			// only a write transaction deletes what it finds has expired
+			if deleted := !db.root().exists("key", latest); deleted != (write && test.deletes) {
+				t.Errorf("Test %d failed: expected the key to be deleted in a write transaction: %t, got %t", i+1, write && test.deletes, deleted)
+			}
+		}
+	}
+}
+
+func TestLazyExpirationRollback(t *testing.T) {
+	fmt.Println("-- TestLazyExpirationRollback")
+	db, _ := Open(&Options{InMemory: true, BackgroundInterval: -1})
+	past := time.Now().Add(-time.Minute).UnixNano()
+	db.ReadWrite(func(tx *Tx) error {
+		tx.insert(tx.db.root(), &Item{"key", "value", newItemMetadata(past)})
+		return nil
+	})
+	commits := countCommits(db)
+
+	failure := errors.New("failure")
+	db.ReadWrite(func(tx *Tx) error {
+		tx.Get("key")
+		return failure
+	})
+	if !db.root().exists("key", latest) || db.root().expires.len() != 1 {
+		t.Errorf("Expected a rollback to put the expired key back")
+	}
+
+	// a write that finds it expired is committed like any other delete
+	if value, err := db.IncrBy("key", 5); err != nil || value != 5 {
+		t.Errorf("Expected the expired key to count as missing, got %d, %v", value, err)
+	}
+	if *commits != 1 {
+		t.Errorf("Expected 1 commit, got %d", *commits)
+	}
+	if db.root().expires.len() != 0 {
+		t.Errorf("Expected the new value to not expire")
+	}
+}
+
+func TestExpirationEvents(t *testing.T) {
+	fmt.Println("-- TestExpirationEvents")
+	failure := errors.New("failure")
+	tests := []struct {
+		op       func(db *DB) error
+		root     []string
+		bucket   []string
+		changes  []Change
+		disabled bool
+	}{
+		// the background sweep
+		{func(db *DB) error { _, err := db.expire(time.Now()); return err }, []string{"key=1"}, []string{"key=2"},
+			[]Change{{ChangeExpire, "", "key", "1", "", true}, {ChangeExpire, "bucket", "key", "2", "", true}}, false},
+		// a write transaction reading an expired key
+		{func(db *DB) error {
+			return db.ReadWrite(func(tx *Tx) error { _, err := tx.Get("key"); return ignoreNotFound(err) })
+		}, []string{"key=1"}, nil, []Change{{ChangeExpire, "", "key", "1", "", true}}, false},
+		// and then writing it again
+		{func(db *DB) error { return db.Set("key", "3") }, []string{"key=1"}, nil,
+			[]Change{{ChangeExpire, "", "key", "1", "", true}, {ChangeSet, "", "key", "", "3", false}}, false},
+		// read transactions don't delete anything
+		{func(db *DB) error { _, err := db.Get("key"); return ignoreNotFound(err) }, nil, nil, nil, false},
+		// nor does a write transaction that's rolled back
+		{func(db *DB) error {
+			db.ReadWrite(func(tx *Tx) error { tx.Get("key"); return failure })
+			return nil
+		}, nil, nil, nil, false},
+		// a key that hasn't expired is just deleted
+		{func(db *DB) error { _, err := db.Delete("other"); return err }, nil, nil,
+			[]Change{{ChangeDelete, "", "other", "value", "", true}}, false},
+		// nothing expires when expiration is disabled
+		{func(db *DB) error { _, err := db.Get("key"); return err }, nil, nil, nil, true},
+	}
+	for i, test := range tests {
+		db, _ := Open(&Options{InMemory: true, BackgroundInterval: -1, DisableExpiration: test.disabled})
+		past := time.Now().Add(-time.Minute).UnixNano()
+		db.ReadWrite(func(tx *Tx) error {
+			b, _ := tx.Bucket("bucket")
+			tx.insert(tx.db.root(), &Item{"key", "1", newItemMetadata(past)})
+			tx.insert(b.managed, &Item{"key", "2", newItemMetadata(past)})
+			tx.SetWithTTL("other", "value", time.Hour)
+			return nil
+		})
+
+		var root, bucket []string
+		var changes []Change
+		db.OnExpire("", func(item Item) { root = append(root, item.Key+"="+item.Value) })
+		db.OnExpire("bucket", func(item Item) { bucket = append(bucket, item.Key+"="+item.Value) })
+		db.OnCommit(func(c []Change) { changes = append(changes, c...) })
+
+		if err := test.op(db); err != nil {
+			t.Errorf("Test %d failed: unexpected error '%s'", i+1, err)
+			continue
+		}
+		if fmt.Sprint(root) != fmt.Sprint(test.root) || fmt.Sprint(bucket) != fmt.Sprint(test.bucket) {
+			t.Errorf("Test %d failed: expected expirations %v and %v, got %v and %v", i+1, test.root, test.bucket, root, bucket)
+		}
+		// the sweep goes through the buckets in no particular order
+		if len(changes) == 2 && changes[0].Bucket == "bucket" && changes[0].Op == ChangeExpire {
+			changes[0], changes[1] = changes[1], changes[0]
+		}
+		if fmt.Sprint(changes) != fmt.Sprint(test.changes) {
+			t.Errorf("Test %d failed: expected changes %v, got %v", i+1, test.changes, changes)
+		}
+	}
+}
+
+func ignoreNotFound(err error) error {
+	if err == ErrKeyNotFound {
+		return nil
+	}
+	return err
+}
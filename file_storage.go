@@ -0,0 +1,316 @@
+package xisdb
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// The database file is a header, an optional snapshot and then an append-only
+// log of records, each one framed so it can be validated when it's read back.
+// Opening the database replays the records in order to rebuild every bucket.
+// The header is a magic string, the version of the file format and, since
+// version 2, the compression the file is written with
+var fileMagic = []byte("xisdb")
+
+const fileVersion = 2
+
+// fileHeader is the header for a file written with the compression
+func fileHeader(c Compression) []byte {
+	return append(append([]byte{}, fileMagic...), fileVersion, byte(c))
+}
+
+// parseFileHeader reads the header at the start of b, returning its length and the
+// compression the file is written with. Version 1 files are never compressed
+func parseFileHeader(b []byte) (int, Compression, error) {
+	n := len(fileMagic)
+	if len(b) <= n || string(b[:n]) != string(fileMagic) {
+		return 0, 0, ErrIncorrectDatabaseFileFormat
+	}
+	switch b[n] {
+	case 1:
+		return n + 1, CompressionNone, nil
+	case 2:
+		if len(b) <= n+1 || !Compression(b[n+1]).valid() {
+			break
+		}
+		return n + 2, Compression(b[n+1]), nil
+	}
+	return 0, 0, ErrIncorrectDatabaseFileFormat
+}
+
+// fileStorage keeps the database in a single file, locked so only one process can write to it
+type fileStorage struct {
+	filename   string
+	header     []byte // header for the file when it's created or rewritten
+	readOnly   bool
+	fileErrors bool // if corruption in the middle of the file fails loading it
+
+	mutex    sync.Mutex // held while the file is written to or replaced
+	file     *os.File
+	size     int64   // size of the file, in bytes
+	dirty    bool    // if the file has been written to since it was last flushed
+	loaded   bool    // if the file has been loaded before, so it's already been repaired
+	appended int64   // how many records were appended before the first one in marks
+	marks    []int64 // where each record appended since the last compaction starts, and where the last one ends
+}
+
+// NewFileStorage opens, or creates, the database file named in the options and locks it.
+// Filename, ReadOnly, LockTimeout, SkipDatabaseFileErrors and Compression are all used as they are by Open
+func NewFileStorage(opts *Options) (Storage, error) {
+	filename := opts.Filename
+	if filename == "" {
+		filename = defaultFilename
+	}
+	if !opts.Compression.valid() {
+		return nil, ErrInvalidCompression
+	}
+
+	flags := os.O_RDWR | os.O_CREATE | os.O_APPEND
+	if opts.ReadOnly {
+		flags = os.O_RDONLY
+	}
+	file, err := openLocked(filename, flags, opts.ReadOnly, opts.LockTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileStorage{
+		filename:   filename,
+		header:     fileHeader(opts.Compression),
+		readOnly:   opts.ReadOnly,
+		fileErrors: !opts.SkipDatabaseFileErrors,
+		file:       file,
+	}, nil
+}
+
+// Load replays the database file. The first time it's loaded, a torn record at the end of the
+// file, from a write that never completed, is truncated. Corruption anywhere else either fails
+// the load or, if file errors are being skipped, is passed over and included in the report
+func (s *fileStorage) Load(fn func(record []byte) error) (RecoveryReport, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return RecoveryReport{}, ErrDatabaseClosed
+	}
+	repair := !s.loaded && !s.readOnly
+	s.loaded = true
+
+	report := RecoveryReport{}
+	info, err := s.file.Stat()
+	if err != nil {
+		return report, err
+	}
+	size := info.Size()
+
+	header := make([]byte, len(s.header))
+	n, _ := s.file.ReadAt(header, 0)
+	if n < len(header) && string(header[:n]) == string(s.header[:n]) {
+		// either a new file, or one whose header was never completely written
+		report.BytesDropped = int64(n)
+		if !repair {
+			return report, nil
+		}
+		if err := s.file.Truncate(0); err != nil {
+			return report, err
+		}
+		if _, err := s.file.Write(s.header); err != nil {
+			return report, err
+		}
+		s.dirty = true
+		s.setSize(int64(len(s.header)))
+		return report, nil
+	}
+	length, _, err := parseFileHeader(header[:n])
+	if err != nil {
+		return report, err
+	}
+
+	rr := newRecordReader(s.file, int64(length), size)
+	for {
+		start := rr.offset
+		record, err := rr.next()
+		if err == io.EOF {
+			break
+		}
+
+		if err == errCorruptRecord {
+			if !rr.resync() {
+				report.BytesDropped += size - start
+				size = start
+				if repair {
+					if err := s.file.Truncate(size); err != nil {
+						return report, err
+					}
+					report.Truncated = true
+				}
+				break
+			}
+			if s.fileErrors {
+				return report, ErrIncorrectDatabaseFileFormat
+			}
+			report.RecordsSkipped++
+			report.BytesDropped += rr.offset - start
+			continue
+		}
+
+		if err := fn(record); err != nil {
+			return report, err
+		}
+	}
+
+	if repair {
+		s.setSize(size)
+	}
+	return report, nil
+}
+
+// setSize sets the size of the file once it's been loaded, nothing has been appended yet
+func (s *fileStorage) setSize(size int64) {
+	s.size = size
+	s.marks = []int64{size}
+}
+
+// Append writes the framed record to the end of the file. If any of it fails the
+// file is truncated back to where it was so a partial write isn't left behind
+func (s *fileStorage) Append(record []byte, sync bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return ErrDatabaseClosed
+	}
+	if s.readOnly {
+		return ErrDatabaseReadOnly
+	}
+
+	b := frameRecord(record)
+	_, err := s.file.Write(b)
+	s.dirty = true
+	if err == nil && sync {
+		err = s.flush()
+	}
+	if err != nil {
+		s.file.Truncate(s.size)
+		return err
+	}
+
+	s.size += int64(len(b))
+	s.marks = append(s.marks, s.size)
+	return nil
+}
+
+// Compact writes the snapshot to a new file that then replaces the database file. Appends
+// aren't held up while the new file is written, only while the records appended since the
+// first n are copied over to it and it's swapped in
+func (s *fileStorage) Compact(snapshot [][]byte, n int64) error {
+	if s.readOnly {
+		return ErrDatabaseReadOnly
+	}
+
+	temp := s.filename + ".compact"
+	file, err := os.OpenFile(temp, os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		file.Close()
+		os.Remove(temp)
+		return err
+	}
+
+	// the new file is locked before it replaces the old one, so it's never left unlocked
+	if _, err = tryLockFile(file, false); err != nil {
+		return fail(err)
+	}
+
+	b := append([]byte{}, s.header...)
+	for _, record := range snapshot {
+		b = append(b, frameRecord(record)...)
+	}
+	if _, err = file.Write(b); err != nil {
+		return fail(err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return fail(ErrDatabaseClosed)
+	}
+
+	marks := s.marks[n-s.appended:]
+	offset := marks[0]
+	tail, err := io.Copy(file, io.NewSectionReader(s.file, offset, s.size-offset))
+	if err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = os.Rename(temp, s.filename)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	syncDir(s.filename)
+
+	s.closeFile()
+	s.file = file
+	s.dirty = false
+	s.size = int64(len(b)) + tail
+	s.appended = n
+	s.marks = make([]int64, len(marks))
+	for i, mark := range marks {
+		s.marks[i] = mark - offset + int64(len(b))
+	}
+	return nil
+}
+
+// Sync flushes the database file if it has been written to
+func (s *fileStorage) Sync() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return ErrDatabaseClosed
+	}
+	return s.flush()
+}
+
+// Close flushes, unlocks and closes the database file
+func (s *fileStorage) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return ErrDatabaseClosed
+	}
+	err := s.flush()
+	return firstNonNil(s.closeFile(), err)
+}
+
+// flush syncs the file if it has been written to. The storage must be locked
+func (s *fileStorage) flush() error {
+	if !s.dirty {
+		return nil
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// closeFile unlocks and closes the database file. The storage must be locked
+func (s *fileStorage) closeFile() error {
+	unlockFile(s.file)
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// syncDir flushes the directory holding the file so a rename survives a crash
+func syncDir(filename string) {
+	dir, err := os.Open(filepath.Dir(filename))
+	if err != nil {
+		return
+	}
+	dir.Sync()
+	dir.Close()
+}
@@ -1,7 +1,7 @@
 package xisdb
 
 import (
-	"strings"
+	"sort"
 
 	"github.com/alexsward/xisdb/indexes"
 	"github.com/alexsward/xisdb/tree"
@@ -30,10 +30,22 @@ func newIndexMatcher(it IndexType, matcher indexes.Matcher) indexMatcher {
 	}
 }
 
+// IndexDefinition describes an index by the names of a registered matcher and comparator, rather
+// than the funcs themselves. That makes it data, so indexes created from one are persisted along
+// with everything else and rebuilt when the database is opened
+type IndexDefinition struct {
+	Name       string
+	Type       IndexType
+	Matcher    indexes.MatcherDefinition
+	Comparator string // defaults to indexes.NaturalOrder
+}
+
 type index struct {
-	name  string
-	match indexMatcher
-	tree  tree.BTree
+	name       string
+	match      indexMatcher
+	compare    tree.Comparator
+	tree       tree.BTree
+	definition *IndexDefinition // how to create the index again, nil if it isn't persisted
 }
 
 func (i *index) String() string {
@@ -42,10 +54,7 @@ func (i *index) String() string {
 
 var (
 	// NaturalOrderKeyComparison -- string.Compare two Items by Key
-	NaturalOrderKeyComparison = func(k1, k2 tree.Key) int {
-		// TODO: these comparators need to be way better
-		return strings.Compare(k1.(string), k1.(string))
-	}
+	NaturalOrderKeyComparison tree.Comparator = indexes.NaturalOrderComparator
 )
 
 type indexNode struct {
@@ -61,25 +70,67 @@ func (in indexNode) Value() interface{} {
 }
 
 func newIndex(name string, it IndexType, m indexes.Matcher, comp tree.Comparator) (*index, error) {
-	tree, err := tree.NewTree(3, NaturalOrderKeyComparison)
+	if comp == nil {
+		comp = NaturalOrderKeyComparison
+	}
+	tree, err := tree.NewTree(3, comp)
 	if err != nil {
 		return nil, err
 	}
 
 	idx := &index{
-		name:  name,
-		match: newIndexMatcher(it, m),
-		tree:  tree,
+		name:    name,
+		match:   newIndexMatcher(it, m),
+		compare: comp,
+		tree:    tree,
 	}
 	return idx, err
 }
 
+// newDefinedIndex creates the index described by the definition, from the registered matcher and comparator
+func newDefinedIndex(def *IndexDefinition) (*index, error) {
+	if def.Name == "" {
+		return nil, ErrInvalidIndexName
+	}
+	m, err := def.Matcher.Matcher()
+	if err != nil {
+		return nil, err
+	}
+	comparator := def.Comparator
+	if comparator == "" {
+		comparator = indexes.NaturalOrder
+	}
+	c, err := indexes.LookupComparator(comparator)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := newIndex(def.Name, def.Type, m, c)
+	if err != nil {
+		return nil, err
+	}
+	idx.definition = def
+	return idx, nil
+}
+
+// build adds every item in the bucket as of version v that matches to the index
+func (i *index) build(b *bucket, v int64) {
+	for _, item := range b.items(v) {
+		if i.match(item) {
+			i.add(item)
+		}
+	}
+}
+
 func (i *index) add(item *Item) {
 	i.tree.Insert(&indexNode{item})
 }
 
-func (i *index) remove(item *Item) {
-	i.tree.Remove(&indexNode{item})
+// remove takes the key out of the index, if it's there
+func (i *index) remove(key string) {
+	if nodes, err := i.tree.Get(key); err == nil {
+		i.tree.Remove(nodes...)
+	}
 }
 
 func (i *index) iterate() <-chan Item {
@@ -95,3 +146,91 @@ func (i *index) iterate() <-chan Item {
 	}(ch)
 	return ch
 }
+
+// MismatchKind is how an index disagrees with the items in its bucket
+type MismatchKind int
+
+const (
+	// MismatchMissing when an item matches the index but isn't in it
+	MismatchMissing MismatchKind = iota
+	// MismatchUnexpected when the index has a key that doesn't exist, doesn't match it, or is in it more than once
+	MismatchUnexpected
+	// MismatchStale when the index has the key, but not with its current value
+	MismatchStale
+)
+
+// IndexMismatch is a key an index disagrees with its bucket about
+type IndexMismatch struct {
+	Bucket string
+	Index  string
+	Key    string
+	Kind   MismatchKind
+}
+
+// VerifyIndexes checks every index against the items in its bucket, returning every key they
+// disagree about, ordered by bucket, index and key. Indexes are kept in sync as items are
+// written and rolled back, so there should never be any
+func (db *DB) VerifyIndexes() ([]IndexMismatch, error) {
+	db.lock()
+	defer db.unlock()
+	if db.isClosed() {
+		return nil, ErrDatabaseClosed
+	}
+
+	var mismatches []IndexMismatch
+	for _, b := range db.buckets {
+		b.mutex.RLock()
+		for _, idx := range b.indexes {
+			mismatches = append(mismatches, idx.verify(b)...)
+		}
+		b.mutex.RUnlock()
+	}
+	sort.Slice(mismatches, func(i, j int) bool {
+		a, b := mismatches[i], mismatches[j]
+		if a.Bucket != b.Bucket {
+			return a.Bucket < b.Bucket
+		}
+		if a.Index != b.Index {
+			return a.Index < b.Index
+		}
+		return a.Key < b.Key
+	})
+	return mismatches, nil
+}
+
+// verify compares the index to the newest items in the bucket, which must be locked
+func (i *index) verify(b *bucket) []IndexMismatch {
+	var mismatches []IndexMismatch
+	mismatch := func(key string, kind MismatchKind) {
+		mismatches = append(mismatches, IndexMismatch{b.name, i.name, key, kind})
+	}
+
+	indexed := make(map[string]*Item)
+	for node := range i.tree.IterateAll() {
+		item := node.Value().(*Item)
+		if _, duplicate := indexed[item.Key]; duplicate {
+			mismatch(item.Key, MismatchUnexpected)
+			continue
+		}
+		indexed[item.Key] = item
+	}
+	for key := range b.data {
+		item, exists := b.find(key, latest)
+		in, found := indexed[key]
+		delete(indexed, key)
+		switch {
+		case !exists || !i.match(item):
+			if found {
+				mismatch(key, MismatchUnexpected)
+			}
+		case !found:
+			mismatch(key, MismatchMissing)
+		case in.Value != item.Value:
+			mismatch(key, MismatchStale)
+		}
+	}
+	for key := range indexed {
+		mismatch(key, MismatchUnexpected)
+	}
+	return mismatches
+}
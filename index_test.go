@@ -1,7 +1,12 @@
 package xisdb
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
 	"testing"
 	"time"
@@ -113,3 +118,339 @@ func createTestItemForIndex(it IndexType, data string, num int) Item {
 	}
 	return Item{data, strconv.Itoa(num), nil}
 }
+
+func indexKeys(t *testing.T, db *DB, name string) []string {
+	var keys []string
+	err := db.Read(func(tx *Tx) error {
+		items, err := tx.iterate(tx.db.root(), name, 0)
+		if err != nil {
+			return err
+		}
+		for item := range items {
+			keys = append(keys, item.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Error iterating index %s: %s", name, err)
+	}
+	return keys
+}
+
+func TestIndexDefinitionPersisted(t *testing.T) {
+	fmt.Println("-- TestIndexDefinitionPersisted")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db := openTestFileDB(t, filename)
+	for _, key := range []string{"user:b", "order:1", "user:a", "user:c"} {
+		db.Set(key, "value")
+	}
+	err := db.CreateIndex(IndexDefinition{Name: "users", Matcher: indexes.Prefix("user:"), Comparator: indexes.ReverseOrder})
+	if err != nil {
+		t.Fatalf("Error creating index: %s", err)
+	}
+	db.CreateIndex(IndexDefinition{Name: "deleted", Matcher: indexes.Wildcard()})
+	db.DeleteIndex("deleted")
+	db.AddIndex("unpersisted", KeyIndex, indexes.WildcardMatcher, NaturalOrderKeyComparison)
+	if err := db.CreateIndex(IndexDefinition{Name: "users", Matcher: indexes.Wildcard()}); err != ErrIndexAlreadyExists {
+		t.Errorf("Expected error '%s' creating a duplicate index, got '%v'", ErrIndexAlreadyExists, err)
+	}
+	db.Close()
+
+	expected := []string{"user:c", "user:b", "user:a"}
+	for _, compact := range []bool{false, true} {
+		db = openTestFileDB(t, filename)
+		if keys := indexKeys(t, db, "users"); !reflect.DeepEqual(keys, expected) {
+			t.Errorf("Expected index to be rebuilt with %v, got %v", expected, keys)
+		}
+		for _, name := range []string{"deleted", "unpersisted"} {
+			if _, exists := db.root().indexes[name]; exists {
+				t.Errorf("Expected index %s to not exist after reopening", name)
+			}
+		}
+		if compact {
+			db.Compact()
+		}
+		db.Close()
+	}
+}
+
+func TestIndexDefinitionRollback(t *testing.T) {
+	fmt.Println("-- TestIndexDefinitionRollback")
+	db := openTestDB()
+	db.CreateIndex(IndexDefinition{Name: "existing", Matcher: indexes.Wildcard()})
+	db.ReadWrite(func(tx *Tx) error {
+		tx.CreateIndex(IndexDefinition{Name: "created", Matcher: indexes.Wildcard()})
+		tx.DeleteIndex("existing")
+		return ErrKeyNotFound
+	})
+	if _, exists := db.root().indexes["created"]; exists {
+		t.Errorf("Expected index created in a rolled back transaction to not exist")
+	}
+	if _, exists := db.root().indexes["existing"]; !exists {
+		t.Errorf("Expected index deleted in a rolled back transaction to still exist")
+	}
+}
+
+func TestIndexDefinitionUnregistered(t *testing.T) {
+	fmt.Println("-- TestIndexDefinitionUnregistered")
+	db := openTestDB()
+	tests := []struct {
+		definition IndexDefinition
+		err        error
+	}{
+		{IndexDefinition{Name: "m", Matcher: indexes.MatcherDefinition{Name: "missing"}}, indexes.ErrMatcherNotRegistered},
+		{IndexDefinition{Name: "c", Matcher: indexes.Wildcard(), Comparator: "missing"}, indexes.ErrComparatorNotRegistered},
+		{IndexDefinition{Matcher: indexes.Wildcard()}, ErrInvalidIndexName},
+	}
+	for i, test := range tests {
+		if err := db.CreateIndex(test.definition); !errors.Is(err, test.err) {
+			t.Errorf("Test %d failed: expected error '%s', got '%v'", i+1, test.err, err)
+		}
+	}
+
+	// an index stored with a matcher that isn't registered fails opening the database
+	e := &encoder{}
+	definition := &IndexDefinition{Name: "m", Matcher: indexes.MatcherDefinition{Name: "missing"}}
+	e.record(recordCommit, 1, []*commit{{op: opCreateIndex, index: definition}})
+	filename := filepath.Join(t.TempDir(), "test.data")
+	os.WriteFile(filename, append(fileHeader(CompressionNone), frameRecord(e.bytes())...), 0666)
+	_, err := Open(&Options{Filename: filename, SkipDatabaseFileErrors: true, BackgroundInterval: -1})
+	if !errors.Is(err, indexes.ErrMatcherNotRegistered) {
+		t.Errorf("Expected error '%s' opening the database, got '%v'", indexes.ErrMatcherNotRegistered, err)
+	}
+}
+
+func TestIndexDefinitionBackup(t *testing.T) {
+	fmt.Println("-- TestIndexDefinitionBackup")
+	db := openTestDB()
+	db.Set("user:a", "value")
+	db.CreateIndex(IndexDefinition{Name: "users", Matcher: indexes.Prefix("user:")})
+	var backup bytes.Buffer
+	db.Backup(&backup)
+
+	restored := openTestDB()
+	restored.CreateIndex(IndexDefinition{Name: "other", Matcher: indexes.Wildcard()})
+	if err := restored.Restore(bytes.NewReader(backup.Bytes())); err != nil {
+		t.Fatalf("Error restoring backup: %s", err)
+	}
+	if keys := indexKeys(t, restored, "users"); !reflect.DeepEqual(keys, []string{"user:a"}) {
+		t.Errorf("Expected the restored index to hold [user:a], got %v", keys)
+	}
+	if _, exists := restored.root().indexes["other"]; exists {
+		t.Errorf("Expected index not in the backup to be removed by restoring")
+	}
+}
+
+func TestIndexMaintenance(t *testing.T) {
+	fmt.Println("-- TestIndexMaintenance")
+	failure := errors.New("failure")
+	tests := []struct {
+		op           func(db *DB)
+		keys, values []string
+	}{
+		{func(db *DB) {}, []string{"a1", "a2"}, []string{"a1", "b1"}},
+		{func(db *DB) { db.Set("a3", "v3") }, []string{"a1", "a2", "a3"}, []string{"a1", "a3", "b1"}},
+		{func(db *DB) { db.Set("a2", "v") }, []string{"a1", "a2"}, []string{"a1", "a2", "b1"}},
+		{func(db *DB) { db.Set("a1", "x") }, []string{"a1", "a2"}, []string{"b1"}},
+		{func(db *DB) { db.Delete("a1") }, []string{"a2"}, []string{"b1"}},
+		{func(db *DB) { db.Delete("missing") }, []string{"a1", "a2"}, []string{"a1", "b1"}},
+		{func(db *DB) { db.Append("a2", "v") }, []string{"a1", "a2"}, []string{"a1", "b1"}},
+		{func(db *DB) {
+			db.ReadWrite(func(tx *Tx) error {
+				tx.Set("a3", "v3", nil)
+				tx.Set("a2", "v2", nil)
+				tx.Delete("a1")
+				return failure
+			})
+		}, []string{"a1", "a2"}, []string{"a1", "b1"}},
+		{func(db *DB) {
+			db.ReadWrite(func(tx *Tx) error {
+				tx.Set("a3", "v3", nil)
+				tx.Savepoint("sp")
+				tx.Set("a4", "v4", nil)
+				tx.Delete("a2")
+				tx.Set("a1", "x", nil)
+				return tx.RollbackTo("sp")
+			})
+		}, []string{"a1", "a2", "a3"}, []string{"a1", "a3", "b1"}},
+		{func(db *DB) {
+			db.ReadWrite(func(tx *Tx) error {
+				tx.Nested(func(tx *Tx) error {
+					tx.Set("a5", "v5", nil)
+					tx.Delete("b1")
+					return failure
+				})
+				return tx.Set("a6", "x", nil)
+			})
+		}, []string{"a1", "a2", "a6"}, []string{"a1", "b1"}},
+		{func(db *DB) {
+			db.ReadWrite(func(tx *Tx) error {
+				tx.Set("a3", "v3", nil)
+				tx.DeleteIndex("keys")
+				tx.Set("a4", "v4", nil)
+				tx.Delete("a1")
+				tx.Delete("a3")
+				return failure
+			})
+		}, []string{"a1", "a2"}, []string{"a1", "b1"}},
+		{func(db *DB) {
+			db.Optimistic(func(tx *Tx) error {
+				tx.Set("a3", "v3", nil)
+				_, err := tx.Delete("b1")
+				return err
+			})
+		}, []string{"a1", "a2", "a3"}, []string{"a1", "a3"}},
+		{func(db *DB) {
+			db.ReadWrite(func(tx *Tx) error {
+				b, _ := tx.Buckets()
+				return b[0].Clear()
+			})
+		}, nil, nil},
+	}
+	for i, test := range tests {
+		db := openTestDB()
+		db.Set("a1", "v1")
+		db.Set("a2", "x")
+		db.Set("b1", "v2")
+		db.AddIndex("keys", KeyIndex, indexes.PrefixMatcher("a"), NaturalOrderKeyComparison)
+		db.AddIndex("values", ValueIndex, indexes.PrefixMatcher("v"), NaturalOrderKeyComparison)
+
+		test.op(db)
+		if keys := indexKeys(t, db, "keys"); !reflect.DeepEqual(keys, test.keys) {
+			t.Errorf("Test %d failed: expected key index %v, got %v", i+1, test.keys, keys)
+		}
+		if values := indexKeys(t, db, "values"); !reflect.DeepEqual(values, test.values) {
+			t.Errorf("Test %d failed: expected value index %v, got %v", i+1, test.values, values)
+		}
+		if mismatches, err := db.VerifyIndexes(); err != nil || len(mismatches) != 0 {
+			t.Errorf("Test %d failed: expected indexes to be in sync, got %v, %v", i+1, mismatches, err)
+		}
+	}
+}
+
+func TestIndexIterateSnapshot(t *testing.T) {
+	fmt.Println("-- TestIndexIterateSnapshot")
+	var pending *Tx
+	tests := []struct {
+		op           func(db *DB)
+		keys, values []string
+		current      bool // if the reader can go by the indexes themselves
+	}{
+		{func(db *DB) {}, []string{"a2", "a1"}, []string{"a1", "b1"}, true},
+		{func(db *DB) { db.Delete("a1") }, []string{"a2", "a1"}, []string{"a1", "b1"}, false},
+		{func(db *DB) { db.Set("a2", "v") }, []string{"a2", "a1"}, []string{"a1", "b1"}, false},
+		{func(db *DB) { db.Set("a1", "x") }, []string{"a2", "a1"}, []string{"a1", "b1"}, false},
+		{func(db *DB) { db.Set("a3", "v3") }, []string{"a2", "a1"}, []string{"a1", "b1"}, false},
+		// a write transaction that hasn't committed yet
+		{func(db *DB) {
+			pending, _ = db.Begin(true)
+			pending.Set("a3", "v3", nil)
+			pending.Delete("b1")
+		}, []string{"a2", "a1"}, []string{"a1", "b1"}, false},
+	}
+	for i, test := range tests {
+		db := openTestDB()
+		db.Set("a1", "v1")
+		db.Set("a2", "x")
+		db.Set("b1", "v2")
+		db.AddIndex("keys", KeyIndex, indexes.PrefixMatcher("a"), indexes.ReverseOrderComparator)
+		db.AddIndex("values", ValueIndex, indexes.PrefixMatcher("v"), NaturalOrderKeyComparison)
+
+		// the reader sees the keys as they were when it began, just like it gets them
+		tx, _ := db.Begin(false)
+		test.op(db)
+		if current := tx.current(); current != test.current {
+			t.Errorf("Test %d failed: expected the reader to be current: %t, got %t", i+1, test.current, current)
+		}
+		for name, expected := range map[string][]string{"keys": test.keys, "values": test.values} {
+			items, err := tx.iterate(db.root(), name, 0)
+			if err != nil {
+				t.Errorf("Test %d failed: error iterating index %s: %s", i+1, name, err)
+				continue
+			}
+			var keys []string
+			for item := range items {
+				if value, _ := tx.Get(item.Key); value != item.Value {
+					t.Errorf("Test %d failed: expected %s to be '%s', got '%s'", i+1, item.Key, value, item.Value)
+				}
+				keys = append(keys, item.Key)
+			}
+			if !reflect.DeepEqual(keys, expected) {
+				t.Errorf("Test %d failed: expected index %s to have %v, got %v", i+1, name, expected, keys)
+			}
+		}
+		tx.Rollback()
+		if pending != nil {
+			pending.Rollback()
+			pending = nil
+		}
+	}
+}
+
+func TestIndexMaintenancePersisted(t *testing.T) {
+	fmt.Println("-- TestIndexMaintenancePersisted")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db := openTestFileDB(t, filename)
+	db.Set("user:a", "value")
+	db.CreateIndex(IndexDefinition{Name: "users", Matcher: indexes.Prefix("user:")})
+	db.Set("user:b", "value")
+	db.Set("user:c", "value")
+	db.Delete("user:a")
+	db.Close()
+
+	for _, compact := range []bool{false, true} {
+		db = openTestFileDB(t, filename)
+		if keys := indexKeys(t, db, "users"); !reflect.DeepEqual(keys, []string{"user:b", "user:c"}) {
+			t.Errorf("Expected index to hold [user:b user:c], got %v", keys)
+		}
+		if mismatches, err := db.VerifyIndexes(); err != nil || len(mismatches) != 0 {
+			t.Errorf("Expected indexes to be in sync, got %v, %v", mismatches, err)
+		}
+		if compact {
+			db.Compact()
+		}
+		db.Close()
+	}
+}
+
+func TestVerifyIndexes(t *testing.T) {
+	fmt.Println("-- TestVerifyIndexes")
+	db := openTestDB()
+	for _, key := range []string{"a1", "a2", "a3", "b1"} {
+		db.Set(key, "value")
+	}
+	db.AddIndex("keys", KeyIndex, indexes.PrefixMatcher("a"), NaturalOrderKeyComparison)
+	db.ReadWrite(func(tx *Tx) error {
+		b, _ := tx.Bucket("bucket")
+		b.Set("a1", "value")
+		return nil
+	})
+
+	idx := db.root().indexes["keys"]
+	idx.remove("a1")
+	idx.remove("a2")
+	idx.add(&Item{"a2", "stale", nil})
+	idx.add(&Item{"a3", "value", nil})
+	idx.add(&Item{"b1", "value", nil})
+	idx.add(&Item{"missing", "value", nil})
+
+	expected := []IndexMismatch{
+		{"", "keys", "a1", MismatchMissing},
+		{"", "keys", "a2", MismatchStale},
+		{"", "keys", "a3", MismatchUnexpected},
+		{"", "keys", "b1", MismatchUnexpected},
+		{"", "keys", "missing", MismatchUnexpected},
+	}
+	mismatches, err := db.VerifyIndexes()
+	if err != nil {
+		t.Fatalf("Error verifying indexes: %s", err)
+	}
+	if !reflect.DeepEqual(mismatches, expected) {
+		t.Errorf("Expected mismatches %v, got %v", expected, mismatches)
+	}
+
+	db.Close()
+	if _, err := db.VerifyIndexes(); err != ErrDatabaseClosed {
+		t.Errorf("Expected error '%s', got '%v'", ErrDatabaseClosed, err)
+	}
+}
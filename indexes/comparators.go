@@ -1 +1,17 @@
 package indexes
+
+import (
+	"strings"
+
+	"github.com/alexsward/xisdb/tree"
+)
+
+// NaturalOrderComparator orders string keys lexicographically
+func NaturalOrderComparator(k1, k2 tree.Key) int {
+	return strings.Compare(k1.(string), k2.(string))
+}
+
+// ReverseOrderComparator orders string keys in reverse lexicographic order
+func ReverseOrderComparator(k1, k2 tree.Key) int {
+	return strings.Compare(k2.(string), k1.(string))
+}
@@ -1 +1,32 @@
 package indexes
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestComparators(t *testing.T) {
+	fmt.Println("-- TestComparators")
+	tests := []struct {
+		name     string
+		k1, k2   string
+		expected int
+	}{
+		{NaturalOrder, "a", "b", -1},
+		{NaturalOrder, "b", "a", 1},
+		{NaturalOrder, "a", "a", 0},
+		{ReverseOrder, "a", "b", 1},
+		{ReverseOrder, "b", "a", -1},
+		{ReverseOrder, "a", "a", 0},
+	}
+	for i, test := range tests {
+		c, err := LookupComparator(test.name)
+		if err != nil {
+			t.Errorf("Test %d failed: error looking up comparator: %s", i+1, err)
+			continue
+		}
+		if result := c(test.k1, test.k2); result != test.expected {
+			t.Errorf("Test %d failed: expected %d comparing '%s' to '%s', got %d", i+1, test.expected, test.k1, test.k2, result)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package indexes
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/alexsward/xisdb/tree"
+)
+
+var (
+	// ErrMatcherNotRegistered when an index uses a matcher that hasn't been registered
+	ErrMatcherNotRegistered = errors.New("Matcher isn't registered")
+	// ErrComparatorNotRegistered when an index uses a comparator that hasn't been registered
+	ErrComparatorNotRegistered = errors.New("Comparator isn't registered")
+	// ErrAlreadyRegistered when a matcher or comparator is registered under a name already taken
+	ErrAlreadyRegistered = errors.New("Name is already registered")
+)
+
+// Names of the built-in matchers and comparators
+const (
+	WildcardMatcherName = "wildcard"
+	PrefixMatcherName   = "prefix"
+	RegexMatcherName    = "regex"
+
+	NaturalOrder = "natural"
+	ReverseOrder = "reverse"
+)
+
+// MatcherFactory creates a Matcher from the argument it was defined with
+type MatcherFactory func(arg string) (Matcher, error)
+
+// MatcherDefinition names a registered matcher and the argument to create it with. Unlike a
+// Matcher it's just data, so an index defined with one can be stored and created again
+type MatcherDefinition struct {
+	Name string
+	Arg  string
+}
+
+// Wildcard defines a matcher that matches all strings
+func Wildcard() MatcherDefinition {
+	return MatcherDefinition{Name: WildcardMatcherName}
+}
+
+// Prefix defines a matcher for strings starting with the prefix
+func Prefix(prefix string) MatcherDefinition {
+	return MatcherDefinition{PrefixMatcherName, prefix}
+}
+
+// Regex defines a matcher for strings matching the regular expression
+func Regex(regex string) MatcherDefinition {
+	return MatcherDefinition{RegexMatcherName, regex}
+}
+
+// registry holds every matcher and comparator that indexes can be defined with, by name
+var registry = struct {
+	sync.RWMutex
+	matchers    map[string]MatcherFactory
+	comparators map[string]tree.Comparator
+}{
+	matchers: map[string]MatcherFactory{
+		WildcardMatcherName: func(string) (Matcher, error) { return WildcardMatcher, nil },
+		PrefixMatcherName:   func(arg string) (Matcher, error) { return PrefixMatcher(arg), nil },
+		RegexMatcherName:    RegexMatcher,
+	},
+	comparators: map[string]tree.Comparator{
+		NaturalOrder: NaturalOrderComparator,
+		ReverseOrder: ReverseOrderComparator,
+	},
+}
+
+// RegisterMatcher makes a matcher available to indexes by name. Databases with indexes
+// defined using it must have it registered before they're opened
+func RegisterMatcher(name string, factory MatcherFactory) error {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, exists := registry.matchers[name]; exists {
+		return fmt.Errorf("%w: matcher '%s'", ErrAlreadyRegistered, name)
+	}
+	registry.matchers[name] = factory
+	return nil
+}
+
+// RegisterComparator makes a comparator available to indexes by name. Databases with indexes
+// defined using it must have it registered before they're opened
+func RegisterComparator(name string, c tree.Comparator) error {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, exists := registry.comparators[name]; exists {
+		return fmt.Errorf("%w: comparator '%s'", ErrAlreadyRegistered, name)
+	}
+	registry.comparators[name] = c
+	return nil
+}
+
+// Matcher creates the matcher defined, using the factory registered under its name
+func (md MatcherDefinition) Matcher() (Matcher, error) {
+	registry.RLock()
+	factory, exists := registry.matchers[md.Name]
+	registry.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("%w: '%s'", ErrMatcherNotRegistered, md.Name)
+	}
+	return factory(md.Arg)
+}
+
+// LookupComparator finds the comparator registered under the name
+func LookupComparator(name string) (tree.Comparator, error) {
+	registry.RLock()
+	c, exists := registry.comparators[name]
+	registry.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("%w: '%s'", ErrComparatorNotRegistered, name)
+	}
+	return c, nil
+}
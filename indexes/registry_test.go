@@ -0,0 +1,53 @@
+package indexes
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRegistryMatchers(t *testing.T) {
+	fmt.Println("-- TestRegistryMatchers")
+	RegisterMatcher("test-suffix", func(arg string) (Matcher, error) {
+		return func(s string) bool { return strings.HasSuffix(s, arg) }, nil
+	})
+
+	tests := []struct {
+		definition MatcherDefinition
+		s          string
+		matches    bool
+		err        error
+	}{
+		{Wildcard(), "anything", true, nil},
+		{Prefix("user:"), "user:1", true, nil},
+		{Prefix("user:"), "order:1", false, nil},
+		{Regex("^[0-9]+$"), "123", true, nil},
+		{Regex("^[0-9]+$"), "abc", false, nil},
+		{MatcherDefinition{"test-suffix", ":1"}, "user:1", true, nil},
+		{MatcherDefinition{"missing", ""}, "", false, ErrMatcherNotRegistered},
+	}
+	for i, test := range tests {
+		m, err := test.definition.Matcher()
+		if !errors.Is(err, test.err) {
+			t.Errorf("Test %d failed: expected error '%v', got '%v'", i+1, test.err, err)
+			continue
+		}
+		if err == nil && m(test.s) != test.matches {
+			t.Errorf("Test %d failed: expected match %t for '%s'", i+1, test.matches, test.s)
+		}
+	}
+}
+
+func TestRegistryDuplicates(t *testing.T) {
+	fmt.Println("-- TestRegistryDuplicates")
+	if err := RegisterMatcher(PrefixMatcherName, nil); !errors.Is(err, ErrAlreadyRegistered) {
+		t.Errorf("Expected error '%s' registering a matcher twice, got '%v'", ErrAlreadyRegistered, err)
+	}
+	if err := RegisterComparator(NaturalOrder, nil); !errors.Is(err, ErrAlreadyRegistered) {
+		t.Errorf("Expected error '%s' registering a comparator twice, got '%v'", ErrAlreadyRegistered, err)
+	}
+	if _, err := LookupComparator("missing"); !errors.Is(err, ErrComparatorNotRegistered) {
+		t.Errorf("Expected error '%s' looking up a missing comparator, got '%v'", ErrComparatorNotRegistered, err)
+	}
+}
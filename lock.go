@@ -0,0 +1,42 @@
+package xisdb
+
+import (
+	"os"
+	"time"
+)
+
+// lockRetryInterval is how long to wait between attempts to lock the database file
+const lockRetryInterval = 10 * time.Millisecond
+
+// openLocked opens the database file and takes an advisory lock on it: shared when read-only,
+// otherwise exclusive. If another process holds a conflicting lock it's retried until the
+// timeout passes, failing with ErrDatabaseLocked. Compaction replaces the file, so once the
+// lock is taken the file is checked to still be the one named, or it's opened all over again
+func openLocked(filename string, flags int, shared bool, timeout time.Duration) (*os.File, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		file, err := os.OpenFile(filename, flags, 0666)
+		if err != nil {
+			return nil, err
+		}
+
+		locked, err := tryLockFile(file, shared)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if locked {
+			if current, err := os.Stat(filename); err == nil {
+				if opened, err := file.Stat(); err == nil && os.SameFile(current, opened) {
+					return file, nil
+				}
+			}
+		}
+
+		file.Close()
+		if !time.Now().Before(deadline) {
+			return nil, ErrDatabaseLocked
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
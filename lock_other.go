@@ -0,0 +1,15 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package xisdb
+
+import "os"
+
+// tryLockFile is a no-op where flock(2) isn't available, the database file is never locked
+func tryLockFile(file *os.File, shared bool) (bool, error) {
+	return true, nil
+}
+
+// unlockFile is a no-op where flock(2) isn't available
+func unlockFile(file *os.File) error {
+	return nil
+}
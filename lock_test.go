@@ -0,0 +1,86 @@
+package xisdb
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockExclusive(t *testing.T) {
+	fmt.Println("-- TestLockExclusive")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db := openTestFileDB(t, filename)
+
+	tests := []struct {
+		readOnly bool
+	}{
+		{false},
+		{true},
+	}
+	for i, test := range tests {
+		_, err := Open(&Options{Filename: filename, ReadOnly: test.readOnly, BackgroundInterval: -1})
+		if err != ErrDatabaseLocked {
+			t.Errorf("Test %d failed: expected error '%s', got '%s'", i+1, ErrDatabaseLocked, err)
+		}
+	}
+
+	// compaction replaces the file, the replacement must still be locked
+	db.Set("key", "value")
+	db.Compact()
+	if _, err := Open(&Options{Filename: filename, BackgroundInterval: -1}); err != ErrDatabaseLocked {
+		t.Errorf("Expected error '%s' after compaction, got '%s'", ErrDatabaseLocked, err)
+	}
+
+	db.Close()
+	db = openTestFileDB(t, filename)
+	db.Close()
+}
+
+func TestLockShared(t *testing.T) {
+	fmt.Println("-- TestLockShared")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	openTestFileDB(t, filename).Close()
+
+	first, err := Open(&Options{Filename: filename, ReadOnly: true, BackgroundInterval: -1})
+	if err != nil {
+		t.Fatalf("Error opening read-only database: %s", err)
+	}
+	second, err := Open(&Options{Filename: filename, ReadOnly: true, BackgroundInterval: -1})
+	if err != nil {
+		t.Fatalf("Expected read-only databases to share the lock, got '%s'", err)
+	}
+	if _, err := Open(&Options{Filename: filename, BackgroundInterval: -1}); err != ErrDatabaseLocked {
+		t.Errorf("Expected error '%s' while shared, got '%s'", ErrDatabaseLocked, err)
+	}
+	first.Close()
+	second.Close()
+}
+
+func TestLockTimeout(t *testing.T) {
+	fmt.Println("-- TestLockTimeout")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db := openTestFileDB(t, filename)
+	db.Set("key", "value")
+
+	start := time.Now()
+	_, err := Open(&Options{Filename: filename, BackgroundInterval: -1, LockTimeout: 30 * time.Millisecond})
+	if err != ErrDatabaseLocked {
+		t.Errorf("Expected error '%s', got '%s'", ErrDatabaseLocked, err)
+	}
+	if waited := time.Since(start); waited < 30*time.Millisecond {
+		t.Errorf("Expected to wait for the lock timeout, only waited %s", waited)
+	}
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		db.Compact()
+		db.Close()
+	}()
+	waiting, err := Open(&Options{Filename: filename, BackgroundInterval: -1, LockTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("Expected to get the lock once the database closed, got '%s'", err)
+	}
+	defer waiting.Close()
+	assertDBKeyValue(t, waiting, "key", "value", true)
+}
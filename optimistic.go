@@ -0,0 +1,105 @@
+package xisdb
+
+import "context"
+
+// optimistic is what an optimistic transaction has read and written. It reads the version of the
+// data it began with, like a read transaction, and keeps its writes to itself until it's committed
+type optimistic struct {
+	touched map[string]struct{} // every key read or written, which mustn't have changed when it commits
+	writes  map[string]*Item    // what each key was set to, nil if it was deleted
+}
+
+func newOptimistic() *optimistic {
+	return &optimistic{
+		touched: make(map[string]struct{}),
+		writes:  make(map[string]*Item),
+	}
+}
+
+// lookup finds the item as it was written by the transaction, or as it was in version v
+func (o *optimistic) lookup(b *bucket, key string, v int64) (*Item, bool) {
+	o.touched[key] = struct{}{}
+	if item, written := o.writes[key]; written {
+		return item, item != nil
+	}
+	return b.get(key, v)
+}
+
+func (o *optimistic) write(key string, item *Item) {
+	o.touched[key] = struct{}{}
+	o.writes[key] = item
+}
+
+// Optimistic runs fn in an optimistic transaction. It reads the database as it was when it began
+// without locking it, so many can run at once alongside a write transaction, and keeps what it
+// writes to itself. When fn returns, the database is locked just long enough to check that no key
+// it read or wrote has been changed since and to commit its writes; if one has, nothing is written
+// and ErrConflict is returned so it can be run again. Optimistic transactions only work with keys
+// in the root bucket, and can't change buckets or indexes
+func (db *DB) Optimistic(fn func(tx *Tx) error) error {
+	if db.readOnly {
+		return ErrDatabaseReadOnly
+	}
+
+	tx, _ := db.begin(context.Background(), false)
+	tx.optimistic = newOptimistic()
+	defer func() {
+		// a panicking fn still ends its transaction, so the version it read can be collected
+		if p := recover(); p != nil {
+			tx.managed = false
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	tx.managed = true
+	err := fn(tx)
+	tx.managed = false
+
+	if err != nil {
+		return firstNonNil(tx.Rollback(), err)
+	}
+	return tx.Commit()
+}
+
+// Update runs fn in an optimistic transaction, running it again, up to retries more times,
+// for as long as it conflicts with other transactions
+func (db *DB) Update(fn func(tx *Tx) error, retries int) error {
+	for {
+		err := db.Optimistic(fn)
+		if err != ErrConflict || retries <= 0 {
+			return err
+		}
+		retries--
+	}
+}
+
+// commitOptimistic checks that nothing the optimistic transaction read or wrote has changed since
+// it began and then commits its writes as a write transaction of their own
+func (db *DB) commitOptimistic(tx *Tx) error {
+	if len(tx.optimistic.writes) == 0 {
+		return db.commit(tx)
+	}
+
+	wtx, err := db.begin(tx.ctx, true)
+	if err != nil {
+		return err
+	}
+	defer wtx.close()
+	b := db.root()
+	for key := range tx.optimistic.touched {
+		if b.changed(key, tx.version) {
+			db.unlock()
+			return ErrConflict
+		}
+	}
+
+	for key, item := range tx.optimistic.writes {
+		if item != nil {
+			wtx.insert(b, item)
+		} else if b.exists(key, latest) {
+			wtx.delete(b, key)
+		}
+	}
+	wtx.hooks = tx.hooks
+	return db.commitWrite(wtx)
+}
@@ -0,0 +1,157 @@
+package xisdb
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestOptimisticCommit(t *testing.T) {
+	fmt.Println("-- TestOptimisticCommit")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db := openTestFileDB(t, filename)
+	db.Set("key", "value")
+	db.Set("deleted", "value")
+
+	hooked := false
+	err := db.Optimistic(func(tx *Tx) error {
+		tx.Hooks(func() { hooked = true })
+		tx.Set("key", "changed", nil)
+		tx.Set("added", "value", nil)
+		if _, err := tx.Delete("deleted"); err != nil {
+			return err
+		}
+		if value, _ := tx.Get("key"); value != "changed" {
+			t.Errorf("Expected an optimistic transaction to read its own writes, got '%s'", value)
+		}
+		if exists, _ := tx.Exists("deleted"); exists {
+			t.Errorf("Expected a key deleted in an optimistic transaction to not exist in it")
+		}
+		// nothing is written until it's committed
+		assertDBKeyValue(t, db, "key", "value", true)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error committing optimistic transaction: %s", err)
+	}
+	if !hooked {
+		t.Errorf("Expected hooks to run once the optimistic transaction committed")
+	}
+	db.Close()
+
+	db = openTestFileDB(t, filename)
+	defer db.Close()
+	assertDBKeyValue(t, db, "key", "changed", true)
+	assertDBKeyValue(t, db, "added", "value", true)
+	if exists, _ := db.Exists("deleted"); exists {
+		t.Errorf("Expected key 'deleted' to not exist")
+	}
+}
+
+func TestOptimisticConflict(t *testing.T) {
+	fmt.Println("-- TestOptimisticConflict")
+	tests := []struct {
+		read, write, changed string
+		err                  error
+	}{
+		{"key", "other", "key", ErrConflict},
+		{"other", "key", "key", ErrConflict},
+		{"missing", "other", "missing", ErrConflict},
+		{"key", "other", "unrelated", nil},
+	}
+	for i, test := range tests {
+		db := openTestDB()
+		db.Set("key", "value")
+		err := db.Optimistic(func(tx *Tx) error {
+			tx.Get(test.read)
+			tx.Set(test.write, "optimistic", nil)
+			// optimistic transactions don't lock the database, so this commits first
+			return db.Set(test.changed, "changed")
+		})
+		if err != test.err {
+			t.Errorf("Test %d failed: expected error '%v', got '%v'", i+1, test.err, err)
+			continue
+		}
+		value, _ := db.Get(test.write)
+		if (value == "optimistic") != (test.err == nil) {
+			t.Errorf("Test %d failed: expected the optimistic write to be committed: %t, got value '%s'", i+1, test.err == nil, value)
+		}
+	}
+}
+
+func TestOptimisticUpdate(t *testing.T) {
+	fmt.Println("-- TestOptimisticUpdate")
+	db := openTestDB()
+	db.Set("counter", "0")
+
+	increment := func(tx *Tx) error {
+		value, _ := tx.Get("counter")
+		n, _ := strconv.Atoi(value)
+		return tx.Set("counter", strconv.Itoa(n+1), nil)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := db.Update(increment, 1000); err != nil {
+				t.Errorf("Error updating counter: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+	assertDBKeyValue(t, db, "counter", "20", true)
+
+	attempts := 0
+	err := db.Update(func(tx *Tx) error {
+		attempts++
+		tx.Get("counter")
+		tx.Set("counter", "optimistic", nil)
+		return db.Set("counter", "changed")
+	}, 2)
+	if err != ErrConflict || attempts != 3 {
+		t.Errorf("Expected error '%s' after 3 attempts, got '%v' after %d", ErrConflict, err, attempts)
+	}
+}
+
+func TestOptimisticErrors(t *testing.T) {
+	fmt.Println("-- TestOptimisticErrors")
+	db := openTestDB()
+	db.Optimistic(func(tx *Tx) error {
+		if _, err := tx.Bucket("b1"); err != ErrNotWriteTransaction {
+			t.Errorf("Expected error '%s' creating a bucket, got '%v'", ErrNotWriteTransaction, err)
+		}
+		if _, err := tx.Delete("missing"); err != ErrKeyNotFound {
+			t.Errorf("Expected error '%s' deleting a missing key, got '%v'", ErrKeyNotFound, err)
+		}
+		return nil
+	})
+
+	// a panic ends the transaction, and panics again in its caller
+	failure := errors.New("failure")
+	func() {
+		defer func() {
+			if r := recover(); r != failure {
+				t.Errorf("Expected a panic with '%s', got '%v'", failure, r)
+			}
+		}()
+		db.Optimistic(func(tx *Tx) error {
+			tx.Set("key", "value", nil)
+			panic(failure)
+		})
+	}()
+	if len(db.readers) != 0 {
+		t.Errorf("Expected no readers left after a panic, got %v", db.readers)
+	}
+	if exists, _ := db.Exists("key"); exists {
+		t.Errorf("Expected nothing to be written by a panicking transaction")
+	}
+
+	readOnly, _ := Open(&Options{InMemory: true, ReadOnly: true, BackgroundInterval: -1})
+	if err := readOnly.Optimistic(func(tx *Tx) error { return nil }); err != ErrDatabaseReadOnly {
+		t.Errorf("Expected error '%s' on a read-only database, got '%v'", ErrDatabaseReadOnly, err)
+	}
+}
@@ -1,5 +1,19 @@
 package xisdb
 
+import "time"
+
+// SyncMode determines when the database file is flushed to stable storage
+type SyncMode int
+
+const (
+	// SyncAlways flushes the database file on every commit, before the transaction returns
+	SyncAlways SyncMode = iota
+	// SyncInterval flushes the database file every BackgroundInterval, so a crash can lose the commits made since
+	SyncInterval
+	// SyncNever leaves flushing the database file to the operating system, other than when the database is closed
+	SyncNever
+)
+
 // Options represents configurable properties that initialize the database
 type Options struct {
 	// Filename is the location of the file to use, or to create
@@ -8,9 +22,25 @@ type Options struct {
 	// InMemory means whether to only save the data in memory
 	InMemory bool
 
+	// EncryptionKey encrypts everything stored, and backups, with AES-GCM. It must be 16, 24 or 32
+	// bytes long to use AES-128, AES-192 or AES-256. Change it with DB.RotateKey
+	EncryptionKey []byte
+
+	// Compression is how records are compressed before they're stored, defaults to CompressionNone.
+	// A database written with any setting can be opened with any other
+	Compression Compression
+
+	// Storage is where to save the data, used instead of the file or InMemory when it's set.
+	// The database takes it over, closing it when the database is closed
+	Storage Storage
+
 	// ReadOnly is to indicate this database is read-only
 	ReadOnly bool
 
+	// LockTimeout is how long to wait for another process to unlock the database file, 0 means not at all.
+	// The file is locked exclusively, or shared between processes when ReadOnly
+	LockTimeout time.Duration
+
 	// SkipDatabaseFileErrors will just pass over database file errors on load
 	SkipDatabaseFileErrors bool
 
@@ -19,4 +49,21 @@ type Options struct {
 
 	// BackgroundInterval (in ms) determines how frequently to perform background cleanup, < 0 means never, 0 defaults to 1000
 	BackgroundInterval int
+
+	// Sync is when to flush the database file to stable storage, defaults to SyncAlways.
+	// SyncInterval relies on background tasks, so with a BackgroundInterval < 0 it never syncs either
+	Sync SyncMode
+
+	// CompactionRatio triggers a compaction once the database file is this many times larger than
+	// after it was last compacted, < 0 means never, 0 defaults to 2. Otherwise it must be at least 1
+	CompactionRatio float64
+
+	// CompactionMinSize (in bytes) is how large the database file must be before it's compacted automatically, 0 defaults to 1MB
+	CompactionMinSize int64
+
+	// MaxBatchSize is the most calls to Batch that are committed together, 0 defaults to 1000
+	MaxBatchSize int
+
+	// MaxBatchDelay is how long a batch waits for more calls to Batch before it's committed, 0 defaults to 10ms
+	MaxBatchDelay time.Duration
 }
@@ -1,9 +1,176 @@
 package xisdb
 
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// Every committed write transaction is stored as a single record: its id, then each
+// of its commits in the order they were made. Opening the database applies the latest
+// snapshot and replays the records after it in order to rebuild every bucket
+
+// errReplayed stops loading once every transaction up to db.until has been replayed
+var errReplayed = errors.New("Replayed")
+
+// openStorage opens the storage chosen in the options and replays its contents. A database
+// that's only kept in memory and has no storage of its own has nothing to open
+func (db *DB) openStorage(opts *Options) error {
+	storage := opts.Storage
+	if storage == nil {
+		if opts.InMemory {
+			return nil
+		}
+		var err error
+		if storage, err = NewFileStorage(opts); err != nil {
+			return err
+		}
+	}
+
+	db.storage = storage
+	err := db.load()
+	if err != nil {
+		storage.Close()
+	}
+	return err
+}
+
+// RecoveryReport describes what happened replaying the storage when the database was opened
+type RecoveryReport struct {
+	RecordsApplied int   // records replayed from the storage
+	RecordsSkipped int   // corrupted records or sections of the file passed over, only with SkipDatabaseFileErrors
+	BytesDropped   int64 // bytes that weren't replayed, either passed over or truncated
+	Truncated      bool  // if a torn record was truncated from the end of the file
+}
+
+// Recovery returns the report of replaying the storage when the database was opened
+func (db *DB) Recovery() RecoveryReport {
+	return db.recovery
+}
+
+// load replays every record in the storage and builds the indexes. Records that can't be decoded
+// or applied either fail the load or, if file errors are being skipped, are passed over and included
+// in the recovery report. Anything else, like the wrong key or an index using a matcher that isn't
+// registered, always fails it. Replaying stops at the first transaction after db.until
 func (db *DB) load() error {
+	applied, skipped, dropped := 0, 0, int64(0)
+	report, err := db.storage.Load(func(record []byte) error {
+		size := int64(len(record))
+		record, err := unpack(db.cipher, record)
+		if err != nil && err != ErrIncorrectDatabaseFileFormat {
+			return err
+		}
+
+		d := &decoder{buf: record}
+		kind, id, commits := d.record()
+		if err == nil && d.err == nil && id > db.until {
+			if kind != recordCommit {
+				return ErrRestorePointUnavailable
+			}
+			return errReplayed
+		}
+
+		db.size += size
+		if err == nil {
+			err = d.err
+		}
+		if err == nil {
+			err = db.apply(commits)
+		}
+		if err != nil {
+			if db.fileErrors || err != ErrIncorrectDatabaseFileFormat {
+				return err
+			}
+			skipped++
+			dropped += size
+			return nil
+		}
+		db.lastID = id
+		applied++
+		return nil
+	})
+	if err != nil && err != errReplayed {
+		return err
+	}
+
+	report.RecordsApplied += applied
+	report.RecordsSkipped += skipped
+	report.BytesDropped += dropped
+	db.recovery = report
+	db.compacted = db.size
+	return nil
+}
+
+// apply makes the changes described by the commits directly against the buckets
+func (db *DB) apply(commits []*commit) error {
+	for _, c := range commits {
+		switch c.op {
+		case opCreateBucket:
+			db.addBucket(c.bucket, BucketOptions{})
+			continue
+		case opDeleteBucket:
+			db.deleteBucket(c.bucket)
+			continue
+		}
+
+		b, exists := db.buckets[c.bucket]
+		if !exists {
+			return ErrIncorrectDatabaseFileFormat
+		}
+		switch c.op {
+		case opSet:
+			b.insert(c.item, db.version)
+		case opDelete:
+			b.delete(c.item.Key, db.version)
+		case opCreateIndex:
+			// the index is kept in sync with everything applied after it
+			idx, err := newDefinedIndex(c.index)
+			if err != nil {
+				return err
+			}
+			idx.build(b, latest)
+			b.indexes[c.index.Name] = idx
+		case opDeleteIndex:
+			delete(b.indexes, c.index.Name)
+		case opBucketOptions:
+			b.options = *c.options
+		case opExpire:
+			if item, exists := b.get(c.item.Key, latest); exists {
+				b.insert(item.withExpiration(c.item.metadata.expiration), db.version)
+			}
+		}
+	}
 	return nil
 }
 
-func (db *DB) persist() error {
+// persist appends a transaction's commits to the storage as a single record,
+// syncing it if every commit must be durable
+func (db *DB) persist(tx *Tx) error {
+	if db.storage == nil || len(tx.commits) == 0 {
+		return nil
+	}
+	if db.isClosed() {
+		return ErrDatabaseClosed
+	}
+
+	e := &encoder{}
+	e.record(recordCommit, tx.id, tx.commits)
+	record := db.pack(e.bytes())
+	if err := db.storage.Append(record, db.sync == SyncAlways); err != nil {
+		return err
+	}
+	db.appended++
+	atomic.AddInt64(&db.size, int64(len(record)))
 	return nil
 }
+
+// Sync flushes everything committed to the storage to stable storage. This is only
+// needed when Options.Sync isn't SyncAlways, as otherwise every commit is flushed
+func (db *DB) Sync() error {
+	if db.storage == nil {
+		return nil
+	}
+	if db.isClosed() {
+		return ErrDatabaseClosed
+	}
+	return db.storage.Sync()
+}
@@ -2,9 +2,208 @@ package xisdb
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
+func openTestFileDB(t *testing.T, filename string) *DB {
+	db, err := Open(&Options{
+		Filename:           filename,
+		BackgroundInterval: -1,
+		DisableExpiration:  true,
+	})
+	if err != nil {
+		t.Fatalf("Error opening database file %s: %s", filename, err)
+	}
+	return db
+}
+
 func TestPersistenceReadFile(t *testing.T) {
 	fmt.Println("-- TestPersistenceReadFile")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db := openTestFileDB(t, filename)
+	db.Set("key1", "value1")
+	db.Set("key2", "value2")
+	db.Set("key1", "value3")
+	db.Delete("key2")
+	db.ReadWrite(func(tx *Tx) error {
+		return tx.Set("expires", "value", &SetMetadata{TTL: 60000})
+	})
+	db.ReadWrite(func(tx *Tx) error {
+		b, err := tx.Bucket("b1")
+		if err != nil {
+			return err
+		}
+		return b.Set("bucketkey", "bucketvalue")
+	})
+	db.Bucket("b2")
+	db.DeleteBucket("b2")
+	db.Close()
+
+	db = openTestFileDB(t, filename)
+	defer db.Close()
+	assertDBKeyValue(t, db, "key1", "value3", true)
+	assertDBKeyValue(t, db, "key2", "", false)
+	assertBucketExists(t, db, "b1", true)
+	assertBucketExists(t, db, "b2", false)
+	if item, exists := db.buckets["b1"].get("bucketkey", latest); !exists || item.Value != "bucketvalue" {
+		t.Errorf("Expected bucketkey in bucket b1 after reopening, got %v", item)
+	}
+	item, exists := db.root().get("expires", latest)
+	if !exists {
+		t.Fatalf("Expected key 'expires' after reopening, didn't find it")
+	}
+	if item.metadata.expiration == nil || item.metadata.expiration.Before(time.Now()) {
+		t.Errorf("Expected key 'expires' to keep its expiration, got %v", item.metadata.expiration)
+	}
+}
+
+func TestPersistenceRollbackNotPersisted(t *testing.T) {
+	fmt.Println("-- TestPersistenceRollbackNotPersisted")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db := openTestFileDB(t, filename)
+	db.Set("key", "value")
+	db.ReadWrite(func(tx *Tx) error {
+		tx.Set("key", "changed", nil)
+		tx.Set("other", "value", nil)
+		return ErrKeyNotFound
+	})
+	db.Close()
+
+	db = openTestFileDB(t, filename)
+	defer db.Close()
+	assertDBKeyValue(t, db, "key", "value", true)
+	if exists, _ := db.Exists("other"); exists {
+		t.Errorf("Expected key from rolled back transaction to not be persisted")
+	}
+}
+
+func TestPersistenceIncorrectFormat(t *testing.T) {
+	fmt.Println("-- TestPersistenceIncorrectFormat")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	os.WriteFile(filename, []byte("not a database file"), 0666)
+	_, err := Open(&Options{Filename: filename, BackgroundInterval: -1})
+	if err != ErrIncorrectDatabaseFileFormat {
+		t.Errorf("Expected error '%s', got '%s'", ErrIncorrectDatabaseFileFormat, err)
+	}
+}
+
+func TestPersistenceClosed(t *testing.T) {
+	fmt.Println("-- TestPersistenceClosed")
+	db := openTestFileDB(t, filepath.Join(t.TempDir(), "test.data"))
+	db.Close()
+	if err := db.Set("key", "value"); err != ErrDatabaseClosed {
+		t.Errorf("Expected error '%s' writing to a closed database, got '%s'", ErrDatabaseClosed, err)
+	}
+}
+
+func TestPersistenceTornRecord(t *testing.T) {
+	fmt.Println("-- TestPersistenceTornRecord")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db := openTestFileDB(t, filename)
+	db.Set("key1", "value1")
+	db.Set("key2", "value2")
+	db.Close()
+
+	size := fileSize(t, filename)
+	os.Truncate(filename, size-3)
+
+	db = openTestFileDB(t, filename)
+	report := db.Recovery()
+	if report.RecordsApplied != 1 || !report.Truncated || report.BytesDropped == 0 {
+		t.Errorf("Expected 1 record applied and the torn record truncated, got %+v", report)
+	}
+	assertDBKeyValue(t, db, "key1", "value1", true)
+	if exists, _ := db.Exists("key2"); exists {
+		t.Errorf("Expected key from the torn record to not exist")
+	}
+	db.Set("key3", "value3")
+	db.Close()
+
+	db = openTestFileDB(t, filename)
+	defer db.Close()
+	if report := db.Recovery(); report.RecordsApplied != 2 || report.BytesDropped != 0 {
+		t.Errorf("Expected a clean replay of 2 records after truncation, got %+v", report)
+	}
+	assertDBKeyValue(t, db, "key3", "value3", true)
+}
+
+func TestPersistenceCorruptRecord(t *testing.T) {
+	fmt.Println("-- TestPersistenceCorruptRecord")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db := openTestFileDB(t, filename)
+	db.Set("key1", "value1")
+	db.Set("key2", "value2")
+	db.Set("key3", "value3")
+	db.Close()
+
+	// flip a byte in the middle of the second record
+	data, _ := os.ReadFile(filename)
+	header := len(fileHeader(CompressionNone))
+	record := (len(data) - header) / 3
+	corrupted := corrupt(data, header+record+record/2)
+	os.WriteFile(filename, corrupted, 0666)
+
+	_, err := Open(&Options{Filename: filename, BackgroundInterval: -1})
+	if err != ErrIncorrectDatabaseFileFormat {
+		t.Errorf("Expected error '%s', got '%s'", ErrIncorrectDatabaseFileFormat, err)
+	}
+
+	db, err = Open(&Options{Filename: filename, BackgroundInterval: -1, SkipDatabaseFileErrors: true})
+	if err != nil {
+		t.Fatalf("Expected corruption to be skipped, got error '%s'", err)
+	}
+	defer db.Close()
+	report := db.Recovery()
+	if report.RecordsApplied != 2 || report.RecordsSkipped != 1 || report.BytesDropped != int64(record) || report.Truncated {
+		t.Errorf("Expected 2 records applied and 1 skipped, got %+v", report)
+	}
+	assertDBKeyValue(t, db, "key1", "value1", true)
+	assertDBKeyValue(t, db, "key3", "value3", true)
+	if exists, _ := db.Exists("key2"); exists {
+		t.Errorf("Expected key from the corrupted record to not exist")
+	}
+}
+
+func TestPersistenceSyncModes(t *testing.T) {
+	fmt.Println("-- TestPersistenceSyncModes")
+	tests := []struct {
+		mode     SyncMode
+		interval int
+		dirty    bool
+	}{
+		{SyncAlways, -1, false},
+		{SyncInterval, 10, false},
+		{SyncInterval, -1, true},
+		{SyncNever, 10, true},
+	}
+	for i, test := range tests {
+		filename := filepath.Join(t.TempDir(), "test.data")
+		db, err := Open(&Options{Filename: filename, Sync: test.mode, BackgroundInterval: test.interval})
+		if err != nil {
+			t.Errorf("Test %d failed: error opening database: %s", i+1, err)
+			continue
+		}
+		db.Set("key", "value")
+		time.Sleep(30 * time.Millisecond)
+
+		storage := db.storage.(*fileStorage)
+		storage.mutex.Lock()
+		dirty := storage.dirty
+		storage.mutex.Unlock()
+		if dirty != test.dirty {
+			t.Errorf("Test %d failed: expected unsynced writes %t, got %t", i+1, test.dirty, dirty)
+		}
+
+		if err := db.Sync(); err != nil {
+			t.Errorf("Test %d failed: error syncing: %s", i+1, err)
+		}
+		db.Close()
+
+		db = openTestFileDB(t, filename)
+		assertDBKeyValue(t, db, "key", "value", true)
+		db.Close()
+	}
 }
@@ -58,8 +58,10 @@ func (s *GetStatement) Validate() error {
 type KeyValuePair map[string]string
 
 // SetStatement is the SET statement/command
+// set key value; set key1 value1 key2 value2 ttl 1000;
 type SetStatement struct {
 	pairs KeyValuePair
+	ttl   int64
 }
 
 // NewSetStatement creates a new default SetStatement
@@ -74,6 +76,11 @@ func (s *SetStatement) Pairs() KeyValuePair {
 	return s.pairs
 }
 
+// TTL returns how many milliseconds until the keys expire, 0 if they never do
+func (s *SetStatement) TTL() int64 {
+	return s.ttl
+}
+
 // Validate ensures at least one key-value pair is included for the statement
 func (s *SetStatement) Validate() error {
 	if len(s.Pairs()) == 0 {
@@ -188,6 +195,9 @@ func (s *SelectStatement) Validate() error {
 	if len(s.Buckets()) > 1 {
 		return ErrCanOnlySelectSingleBucket
 	}
+	if len(s.Indexes()) > 1 {
+		return ErrCanOnlyUseSingleIndex
+	}
 	return nil
 }
 
@@ -195,3 +205,200 @@ func (s *SelectStatement) Validate() error {
 func (s *SelectStatement) Equals(other Statement) bool {
 	return false
 }
+
+// IncrStatement increments the number stored at a key
+// incr key; incrby key 10; incrbyfloat key 1.5;
+type IncrStatement struct {
+	key     string
+	by      int64
+	byFloat float64
+	float   bool
+}
+
+// NewIncrStatement creates an IncrStatement incrementing the key by 1
+func NewIncrStatement(key string) *IncrStatement {
+	return &IncrStatement{key: key, by: 1}
+}
+
+// Key returns the key being incremented
+func (s *IncrStatement) Key() string {
+	return s.key
+}
+
+// By returns the integer increment, for INCR and INCRBY
+func (s *IncrStatement) By() int64 {
+	return s.by
+}
+
+// ByFloat returns the float increment, for INCRBYFLOAT
+func (s *IncrStatement) ByFloat() float64 {
+	return s.byFloat
+}
+
+// Float tells you if this is an INCRBYFLOAT
+func (s *IncrStatement) Float() bool {
+	return s.float
+}
+
+// Validate ensures there's a key to increment
+func (s *IncrStatement) Validate() error {
+	if s.key == "" {
+		return errors.New("Cannot increment nothing")
+	}
+	return nil
+}
+
+// Equals determines if two statements are equivalent
+func (s *IncrStatement) Equals(other Statement) bool {
+	return false
+}
+
+// UpdateStatement sets a key based on whether or how it's currently set
+// append key value; getset key value; setnx key value; setxx key value;
+type UpdateStatement struct {
+	command    TokenType
+	key, value string
+}
+
+// NewUpdateStatement creates a new UpdateStatement for one of APPEND, GETSET, SETNX or SETXX
+func NewUpdateStatement(command TokenType, key, value string) *UpdateStatement {
+	return &UpdateStatement{command, key, value}
+}
+
+// Command returns which of APPEND, GETSET, SETNX or SETXX this is
+func (s *UpdateStatement) Command() TokenType {
+	return s.command
+}
+
+// Key returns the key being updated
+func (s *UpdateStatement) Key() string {
+	return s.key
+}
+
+// Value returns the value given to the command
+func (s *UpdateStatement) Value() string {
+	return s.value
+}
+
+// Validate ensures there's a key to update
+func (s *UpdateStatement) Validate() error {
+	if s.key == "" {
+		return errors.New("Cannot update nothing")
+	}
+	return nil
+}
+
+// Equals determines if two statements are equivalent
+func (s *UpdateStatement) Equals(other Statement) bool {
+	return false
+}
+
+// CASStatement sets a key only if it currently holds the old value
+// cas key old new;
+type CASStatement struct {
+	key, old, new string
+}
+
+// NewCASStatement creates a new CASStatement
+func NewCASStatement(key, old, new string) *CASStatement {
+	return &CASStatement{key, old, new}
+}
+
+// Key returns the key being swapped
+func (s *CASStatement) Key() string {
+	return s.key
+}
+
+// Old returns the value the key must hold to be swapped
+func (s *CASStatement) Old() string {
+	return s.old
+}
+
+// New returns the value the key is swapped to
+func (s *CASStatement) New() string {
+	return s.new
+}
+
+// Validate ensures there's a key to swap
+func (s *CASStatement) Validate() error {
+	if s.key == "" {
+		return errors.New("Cannot swap nothing")
+	}
+	return nil
+}
+
+// Equals determines if two statements are equivalent
+func (s *CASStatement) Equals(other Statement) bool {
+	return false
+}
+
+// ExpireStatement sets or removes when a key expires
+// expire key 1000; expireat key 1700000000000; persist key;
+type ExpireStatement struct {
+	command TokenType
+	key     string
+	ms      int64
+}
+
+// NewExpireStatement creates a new ExpireStatement for one of EXPIRE, EXPIREAT or PERSIST
+func NewExpireStatement(command TokenType, key string, ms int64) *ExpireStatement {
+	return &ExpireStatement{command, key, ms}
+}
+
+// Command returns which of EXPIRE, EXPIREAT or PERSIST this is
+func (s *ExpireStatement) Command() TokenType {
+	return s.command
+}
+
+// Key returns the key to expire
+func (s *ExpireStatement) Key() string {
+	return s.key
+}
+
+// Milliseconds returns the milliseconds until the key expires for EXPIRE, or the unix time
+// in milliseconds it expires at for EXPIREAT
+func (s *ExpireStatement) Milliseconds() int64 {
+	return s.ms
+}
+
+// Validate ensures there's a key to expire
+func (s *ExpireStatement) Validate() error {
+	if s.key == "" {
+		return errors.New("Cannot expire nothing")
+	}
+	return nil
+}
+
+// Equals determines if two statements are equivalent
+func (s *ExpireStatement) Equals(other Statement) bool {
+	return false
+}
+
+// TTLStatement asks how long until a key expires
+// ttl key;
+type TTLStatement struct {
+	key string
+}
+
+// NewTTLStatement creates a new TTLStatement
+func NewTTLStatement(key string) *TTLStatement {
+	return &TTLStatement{key}
+}
+
+// Key returns the key being asked about
+func (s *TTLStatement) Key() string {
+	return s.key
+}
+
+// Validate ensures there's a key to ask about
+func (s *TTLStatement) Validate() error {
+	if s.key == "" {
+		return errors.New("Cannot get the TTL of nothing")
+	}
+	return nil
+}
+
+// Equals determines if two statements are equivalent
+func (s *TTLStatement) Equals(other Statement) bool {
+	return false
+}
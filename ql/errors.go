@@ -19,6 +19,8 @@ var (
 	ErrNoBucketIdentifier = errors.New("Must provide a bucket identifier")
 	// ErrCanOnlySelectSingleBucket when you attempt to select from multiple buckets
 	ErrCanOnlySelectSingleBucket = errors.New("Can only select from a single bucket")
+	// ErrCanOnlyUseSingleIndex when you attempt to select using multiple indexes
+	ErrCanOnlyUseSingleIndex = errors.New("Can only select using a single index")
 	// ErrNoLimitProvided when a LIMIT clause has no value
 	ErrNoLimitProvided = errors.New("Limit clause requires a provided numeric value")
 	// ErrLimitMustBeInteger when a LIMIT clause isn't followed by an integer
@@ -37,4 +39,12 @@ var (
 	ErrIncompleteStatement = errors.New("Incomplete statement")
 	// ErrBothKeyValueRequired when a SET command doens't have a key and value
 	ErrBothKeyValueRequired = errors.New("SET requires both key and value")
+	// ErrWrongNumberOfArguments when a statement like INCRBY or CAS has too few or too many arguments
+	ErrWrongNumberOfArguments = errors.New("Wrong number of arguments for statement")
+	// ErrIncrementMustBeNumber when INCRBY or INCRBYFLOAT isn't given a number
+	ErrIncrementMustBeNumber = errors.New("Increment must be a number")
+	// ErrTTLMustBeInteger when a SET's TTL clause isn't followed by a positive integer
+	ErrTTLMustBeInteger = errors.New("TTL value must be a positive integer")
+	// ErrExpirationMustBeInteger when EXPIRE or EXPIREAT isn't given an integer
+	ErrExpirationMustBeInteger = errors.New("Expiration must be an integer")
 )
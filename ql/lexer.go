@@ -47,11 +47,13 @@ func (l *Lexer) Tokenize() ([]*Token, error) {
 				raw := l.query[start : start+ahead]
 				tokens = append(tokens, &Token{raw, getToken(raw)})
 				l.advance(ahead - 1)
-			} else if isNumber(l.char) {
-				ahead := l.match(isNumber)
-				raw := l.query[start : start+ahead]
-				tokens = append(tokens, &Token{raw, INTEGER})
-				l.advance(ahead - 1)
+			} else if isNumber(l.char) || l.char == '-' {
+				token, ok := l.number()
+				if !ok {
+					tokens = append(tokens, &Token{[]byte{}, ILLEGAL})
+					return tokens, ErrIllegalToken
+				}
+				tokens = append(tokens, token)
 			} else {
 				tokens = append(tokens, &Token{[]byte{}, ILLEGAL})
 				return tokens, ErrIllegalToken
@@ -61,6 +63,34 @@ func (l *Lexer) Tokenize() ([]*Token, error) {
 	return tokens, nil
 }
 
+// number lexes an INTEGER or a FLOAT, either of which may be negative, starting at l.position
+func (l *Lexer) number() (*Token, bool) {
+	start, end := l.position, l.position
+	digits := func() int {
+		n := 0
+		for ; end < len(l.query) && isNumber(l.query[end]); end++ {
+			n++
+		}
+		return n
+	}
+	if l.query[end] == '-' {
+		end++
+	}
+	if digits() == 0 {
+		return nil, false
+	}
+	tokenType := INTEGER
+	if end < len(l.query) && l.query[end] == '.' {
+		end++
+		if digits() == 0 {
+			return nil, false
+		}
+		tokenType = FLOAT
+	}
+	l.advance(end - start - 1)
+	return &Token{l.query[start:end], tokenType}, true
+}
+
 // match tells you how many of the charcters, starting at l.position, match the predicate
 func (l *Lexer) match(predicate func(byte) bool) int {
 	i := 0
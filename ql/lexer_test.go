@@ -114,6 +114,14 @@ func TestLexerMultipleTokens(t *testing.T) {
 			str:      "select;",
 			expected: []TokenType{SELECT, SEMICOLON},
 		},
+		{
+			str:      "incr incrby incrbyfloat append getset setnx setxx cas",
+			expected: []TokenType{INCR, INCRBY, INCRBYFLOAT, APPEND, GETSET, SETNX, SETXX, CAS},
+		},
+		{
+			str:      "incrbyfloat key -1.5 10 -10 0.25;",
+			expected: []TokenType{INCRBYFLOAT, IDENTIFIER, FLOAT, INTEGER, INTEGER, FLOAT, SEMICOLON},
+		},
 	}
 	for i, test := range tests {
 		lexer, _ := NewLexer(test.str)
@@ -144,6 +152,9 @@ func TestLexerNonKeywords(t *testing.T) {
 		{"index1", nil, Token{[]byte("index1"), IDENTIFIER}},
 		{"abc", nil, Token{[]byte("abc"), IDENTIFIER}},
 		{"123", nil, Token{[]byte("123"), INTEGER}},
+		{"-123", nil, Token{[]byte("-123"), INTEGER}},
+		{"1.25", nil, Token{[]byte("1.25"), FLOAT}},
+		{"-1.25", nil, Token{[]byte("-1.25"), FLOAT}},
 	}
 	for i, test := range tests {
 		lexer, _ := NewLexer(test.str)
@@ -158,3 +169,14 @@ func TestLexerNonKeywords(t *testing.T) {
 		}
 	}
 }
+
+func TestLexerIllegalNumbers(t *testing.T) {
+	fmt.Println("-- TestLexerIllegalNumbers")
+	tests := []string{"-", "- 1", "1.", "1.a", "-.5", "--1"}
+	for i, test := range tests {
+		lexer, _ := NewLexer(test)
+		if _, err := lexer.Tokenize(); err != ErrIllegalToken {
+			t.Errorf("Test %d failed: expected error '%s' for '%s', got '%s'", i+1, ErrIllegalToken, test, err)
+		}
+	}
+}
@@ -65,6 +65,36 @@ func (p *Parser) Parse() ([]Statement, error) {
 					return statements, err
 				}
 				statements = append(statements, s)
+			case INCR, INCRBY, INCRBYFLOAT:
+				s, err := p.parseIncrStatement(token.tokenType)
+				if err != nil {
+					return statements, err
+				}
+				statements = append(statements, s)
+			case APPEND, GETSET, SETNX, SETXX:
+				s, err := p.parseUpdateStatement(token.tokenType)
+				if err != nil {
+					return statements, err
+				}
+				statements = append(statements, s)
+			case CAS:
+				s, err := p.parseCASStatement()
+				if err != nil {
+					return statements, err
+				}
+				statements = append(statements, s)
+			case EXPIRE, EXPIREAT, PERSIST:
+				s, err := p.parseExpireStatement(token.tokenType)
+				if err != nil {
+					return statements, err
+				}
+				statements = append(statements, s)
+			case TTL:
+				s, err := p.parseTTLStatement()
+				if err != nil {
+					return statements, err
+				}
+				statements = append(statements, s)
 			default:
 				return statements, ErrCannotParseStatement
 			}
@@ -143,7 +173,7 @@ func (p *Parser) peek() (*Token, bool) {
 	return p.peekAt(p.position + 1)
 }
 
-var statements = []TokenType{SELECT, GET, DEL, SET, EXISTS}
+var statements = []TokenType{SELECT, GET, DEL, SET, EXISTS, INCR, INCRBY, INCRBYFLOAT, APPEND, GETSET, SETNX, SETXX, CAS, EXPIRE, EXPIREAT, PERSIST, TTL}
 
 // isStatement tells you if the token is specific to a given statement
 func (p *Parser) isStatement(tok *Token) bool {
@@ -163,7 +193,17 @@ func (p *Parser) isEnd() bool {
 // it is the responsibility of the caller method to advance the parser to the first IDENTIFIER
 // the reason for this is if there are LPAREN/RPAREN surrounding them, or similar uses
 func (p *Parser) extractIdentifiers() ([]*Token, error) {
-	last, ok := p.indexOfLast(IDENTIFIER.equalsTokenType)
+	return p.extract(IDENTIFIER.equalsTokenType)
+}
+
+// extractWords is extractIdentifiers for keys, which can be named like keywords too
+func (p *Parser) extractWords() ([]*Token, error) {
+	return p.extract((*Token).isWord)
+}
+
+// extract finds all the tokens matching the predicate, starting at the current position
+func (p *Parser) extract(predicate func(*Token) bool) ([]*Token, error) {
+	last, ok := p.indexOfLast(predicate)
 	if !ok {
 		return nil, ErrCannotFindIdentifiers
 	}
@@ -180,18 +220,19 @@ func (p *Parser) parseGetStatement() (*GetStatement, error) {
 
 	g := NewGetStatement()
 	for p.next() || !p.isEnd() {
-		switch p.current().tokenType {
-		case IDENTIFIER:
-			ids, err := p.extractIdentifiers()
+		switch token := p.current(); {
+		case token.isWord():
+			ids, err := p.extractWords()
 			if err != nil {
 				return g, err
 			}
 			for _, tok := range ids {
 				g.addKeys(string(tok.raw))
 			}
-			p.advance(len(ids))
-		case SEMICOLON:
-			// return g, nil
+			p.advance(len(ids) - 1)
+		case token.tokenType == SEMICOLON:
+			// the next statement could start with a keyword that's also a key
+			return g, nil
 		default:
 			return g, ErrUnknownToken
 		}
@@ -202,43 +243,57 @@ func (p *Parser) parseGetStatement() (*GetStatement, error) {
 
 func (p *Parser) parseSetStatement() (*SetStatement, error) {
 	s := NewSetStatement()
-	for p.next() || !p.isEnd() {
-		switch p.current().tokenType {
-		case IDENTIFIER:
-			kvps, err := p.extractIdentifiers()
-			if err != nil {
+	var kvps []*Token
+	for p.next() && p.current().tokenType != SEMICOLON {
+		switch token := p.current(); {
+		case token.tokenType == TTL && len(kvps) > 0 && len(kvps)%2 == 0:
+			// it's only the TTL clause after a key and its value, otherwise it's one of them
+			if err := p.parseTTL(s); err != nil {
 				return s, err
 			}
-			if len(kvps)%2 != 0 {
-				return s, ErrBothKeyValueRequired
-			}
-			for i := 0; i < len(kvps); i += 2 {
-				key := string(kvps[i].raw)
-				s.pairs[key] = string(kvps[i+1].raw)
-			}
-			p.advance(len(kvps))
-		case SEMICOLON:
+		case token.isWord(), token.tokenType == INTEGER, token.tokenType == FLOAT:
+			kvps = append(kvps, token)
 		default:
 			return s, ErrUnknownToken
 		}
 	}
+	if len(kvps)%2 != 0 {
+		return s, ErrBothKeyValueRequired
+	}
+	for i := 0; i < len(kvps); i += 2 {
+		s.pairs[string(kvps[i].raw)] = string(kvps[i+1].raw)
+	}
 	return s, nil
 }
 
+// parseTTL parses the milliseconds of a SET's TTL clause
+func (p *Parser) parseTTL(s *SetStatement) error {
+	if !p.next() || p.current().tokenType != INTEGER {
+		return ErrTTLMustBeInteger
+	}
+	ttl, err := strconv.ParseInt(string(p.current().raw), 10, 64)
+	if err != nil || ttl <= 0 {
+		return ErrTTLMustBeInteger
+	}
+	s.ttl = ttl
+	return nil
+}
+
 func (p *Parser) parseDelStatement() (*DelStatement, error) {
 	s := NewDelStatement()
 	for p.next() {
-		switch p.current().tokenType {
-		case IDENTIFIER:
-			ids, err := p.extractIdentifiers()
+		switch token := p.current(); {
+		case token.isWord():
+			ids, err := p.extractWords()
 			if err != nil {
 				return s, err
 			}
 			for _, tok := range ids {
 				s.addKeys(string(tok.raw))
 			}
-			p.advance(len(ids))
-		case SEMICOLON:
+			p.advance(len(ids) - 1)
+		case token.tokenType == SEMICOLON:
+			return s, nil
 		default:
 			return s, ErrUnknownToken
 		}
@@ -246,6 +301,109 @@ func (p *Parser) parseDelStatement() (*DelStatement, error) {
 	return s, nil
 }
 
+// arguments collects the words and numbers up to the end of the statement
+func (p *Parser) arguments() ([]*Token, error) {
+	var args []*Token
+	for p.next() {
+		switch token := p.current(); {
+		case token.isWord(), token.tokenType == INTEGER, token.tokenType == FLOAT:
+			args = append(args, token)
+		case token.tokenType == SEMICOLON:
+			return args, nil
+		default:
+			return args, ErrUnknownToken
+		}
+	}
+	return args, nil
+}
+
+// parseIncrStatement parses INCR key, INCRBY key n and INCRBYFLOAT key f
+func (p *Parser) parseIncrStatement(command TokenType) (*IncrStatement, error) {
+	args, err := p.arguments()
+	if err != nil {
+		return nil, err
+	}
+	if command == INCR && len(args) != 1 || command != INCR && len(args) != 2 {
+		return nil, ErrWrongNumberOfArguments
+	}
+	s := NewIncrStatement(string(args[0].raw))
+	switch command {
+	case INCRBY:
+		if args[1].tokenType != INTEGER {
+			return nil, ErrIncrementMustBeNumber
+		}
+		if s.by, err = strconv.ParseInt(string(args[1].raw), 10, 64); err != nil {
+			return nil, ErrIncrementMustBeNumber
+		}
+	case INCRBYFLOAT:
+		if args[1].tokenType != INTEGER && args[1].tokenType != FLOAT {
+			return nil, ErrIncrementMustBeNumber
+		}
+		if s.byFloat, err = strconv.ParseFloat(string(args[1].raw), 64); err != nil {
+			return nil, ErrIncrementMustBeNumber
+		}
+		s.float = true
+	}
+	return s, nil
+}
+
+// parseUpdateStatement parses APPEND, GETSET, SETNX and SETXX, which all take a key and a value
+func (p *Parser) parseUpdateStatement(command TokenType) (*UpdateStatement, error) {
+	args, err := p.arguments()
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != 2 {
+		return nil, ErrWrongNumberOfArguments
+	}
+	return NewUpdateStatement(command, string(args[0].raw), string(args[1].raw)), nil
+}
+
+// parseCASStatement parses CAS key old new
+func (p *Parser) parseCASStatement() (*CASStatement, error) {
+	args, err := p.arguments()
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != 3 {
+		return nil, ErrWrongNumberOfArguments
+	}
+	return NewCASStatement(string(args[0].raw), string(args[1].raw), string(args[2].raw)), nil
+}
+
+// parseExpireStatement parses EXPIRE key ms, EXPIREAT key ms and PERSIST key
+func (p *Parser) parseExpireStatement(command TokenType) (*ExpireStatement, error) {
+	args, err := p.arguments()
+	if err != nil {
+		return nil, err
+	}
+	if command == PERSIST && len(args) != 1 || command != PERSIST && len(args) != 2 {
+		return nil, ErrWrongNumberOfArguments
+	}
+	s := NewExpireStatement(command, string(args[0].raw), 0)
+	if command != PERSIST {
+		if args[1].tokenType != INTEGER {
+			return nil, ErrExpirationMustBeInteger
+		}
+		if s.ms, err = strconv.ParseInt(string(args[1].raw), 10, 64); err != nil {
+			return nil, ErrExpirationMustBeInteger
+		}
+	}
+	return s, nil
+}
+
+// parseTTLStatement parses TTL key
+func (p *Parser) parseTTLStatement() (*TTLStatement, error) {
+	args, err := p.arguments()
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != 1 {
+		return nil, ErrWrongNumberOfArguments
+	}
+	return NewTTLStatement(string(args[0].raw)), nil
+}
+
 func (p *Parser) parseSelectStatement() (*SelectStatement, error) {
 	s := NewSelectStatement()
 	for p.next() || !p.isEnd() {
@@ -114,6 +114,10 @@ func TestParserGetStatement(t *testing.T) {
 		{"get key", nil, []string{"key"}},
 		{"get key;", nil, []string{"key"}},
 		{"get", ErrIncompleteStatement, []string{}},
+		// keywords can be keys
+		{"get cas;", nil, []string{"cas"}},
+		{"get incr append getset", nil, []string{"incr", "append", "getset"}},
+		{"get ttl expire;", nil, []string{"ttl", "expire"}},
 		// {"get;", ErrIncompleteStatement, []string{}},
 	}
 	for i, test := range tests {
@@ -147,15 +151,29 @@ func TestParserSetStatement(t *testing.T) {
 		statement string
 		err       error
 		expected  map[string]string
+		ttl       int64
 	}{
-		{"set key value;", nil, map[string]string{"key": "value"}},
-		{"set key value", nil, map[string]string{"key": "value"}},
-		{"set key value key2 value2", nil, map[string]string{"key": "value", "key2": "value2"}},
-		{"set key value key2 value2;", nil, map[string]string{"key": "value", "key2": "value2"}},
+		{"set key value;", nil, map[string]string{"key": "value"}, 0},
+		{"set key value", nil, map[string]string{"key": "value"}, 0},
+		{"set key value key2 value2", nil, map[string]string{"key": "value", "key2": "value2"}, 0},
+		{"set key value key2 value2;", nil, map[string]string{"key": "value", "key2": "value2"}, 0},
 		// {"set", ErrCannotFindIdentifiers, nil},
 		// {"set;", ErrCannotFindIdentifiers, nil},
-		{"set key", ErrBothKeyValueRequired, nil},
-		{"set key;", ErrBothKeyValueRequired, nil},
+		{"set key", ErrBothKeyValueRequired, nil, 0},
+		{"set key;", ErrBothKeyValueRequired, nil, 0},
+		{"set counter 10;", nil, map[string]string{"counter": "10"}, 0},
+		{"set price -1.5 count 2", nil, map[string]string{"price": "-1.5", "count": "2"}, 0},
+		{"set cas incrby setnx setxx;", nil, map[string]string{"cas": "incrby", "setnx": "setxx"}, 0},
+		{"set key value ttl 1000;", nil, map[string]string{"key": "value"}, 1000},
+		{"set key value key2 value2 ttl 5", nil, map[string]string{"key": "value", "key2": "value2"}, 5},
+		{"set key value ttl;", ErrTTLMustBeInteger, nil, 0},
+		{"set key value ttl 0;", ErrTTLMustBeInteger, nil, 0},
+		{"set key value ttl -5;", ErrTTLMustBeInteger, nil, 0},
+		{"set key value ttl 1.5;", ErrTTLMustBeInteger, nil, 0},
+		{"set ttl value;", nil, map[string]string{"ttl": "value"}, 0},
+		{"set key ttl;", nil, map[string]string{"key": "ttl"}, 0},
+		{"set ttl ttl ttl 10;", nil, map[string]string{"ttl": "ttl"}, 10},
+		{"set expire persist expireat 5;", nil, map[string]string{"expire": "persist", "expireat": "5"}, 0},
 	}
 	for i, test := range tests {
 		s, err := parseSingleStatement(test.statement)
@@ -170,6 +188,9 @@ func TestParserSetStatement(t *testing.T) {
 			t.Errorf("Test %d failed: Expected a SetStatement, got a %T", i+1, s)
 			continue
 		}
+		if statement.TTL() != test.ttl {
+			t.Errorf("Test %d failed: Expected a TTL of %d, got %d", i+1, test.ttl, statement.TTL())
+		}
 		pairs := statement.Pairs()
 		if len(pairs) != len(test.expected) {
 			t.Errorf("Test %d failed: Expected %d items to be set, got %d", i+1, len(test.expected), len(pairs))
@@ -199,6 +220,8 @@ func TestParserDelStatement(t *testing.T) {
 		{"del key;", nil, []string{"key"}},
 		{"del key1 key2", nil, []string{"key1", "key2"}},
 		{"del key1 key2;", nil, []string{"key1", "key2"}},
+		{"del incrbyfloat getset;", nil, []string{"incrbyfloat", "getset"}},
+		{"del ttl persist", nil, []string{"ttl", "persist"}},
 	}
 	for i, test := range tests {
 		s, err := parseSingleStatement(test.statement)
@@ -234,7 +257,7 @@ func TestParserSingleSelect(t *testing.T) {
 		{"select from bucket bucket1 bucket2 limit 10;", nil, []string{"bucket1", "bucket2"}, nil, 10},
 		{"select from bucket bucket1 limit;", ErrLimitMustBeInteger, nil, nil, 0},
 		{"select from bucket bucket1 limit a;", ErrLimitMustBeInteger, nil, nil, 0},
-		{"select from bucket bucket1 limit 17.3;", ErrIllegalToken, []string{"bucket1"}, nil, 10},
+		{"select from bucket bucket1 limit 17.3;", ErrLimitMustBeInteger, []string{"bucket1"}, nil, 10},
 		{"select nothing", ErrUnparsedIdentifier, nil, nil, 0},
 		{"select use index index1 limit 1;", nil, nil, []string{"index1"}, 1},
 		{"select use index index1 index2 limit 1;", nil, nil, []string{"index1", "index2"}, 1},
@@ -277,6 +300,224 @@ func TestParserSingleSelect(t *testing.T) {
 	}
 }
 
+func TestParserIncrStatement(t *testing.T) {
+	fmt.Println("-- TestParserIncrStatement")
+	tests := []struct {
+		statement string
+		err       error
+		key       string
+		by        int64
+		byFloat   float64
+		float     bool
+	}{
+		{"incr key", nil, "key", 1, 0, false},
+		{"incr key;", nil, "key", 1, 0, false},
+		{"incrby key 10;", nil, "key", 10, 0, false},
+		{"incrby key -10;", nil, "key", -10, 0, false},
+		{"incrbyfloat key 1.5;", nil, "key", 1, 1.5, true},
+		{"incrbyfloat key -2;", nil, "key", 1, -2, true},
+		{"incr;", ErrWrongNumberOfArguments, "", 0, 0, false},
+		{"incr key 10;", ErrWrongNumberOfArguments, "", 0, 0, false},
+		{"incrby key;", ErrWrongNumberOfArguments, "", 0, 0, false},
+		{"incrby key 1.5;", ErrIncrementMustBeNumber, "", 0, 0, false},
+		{"incrby key ten;", ErrIncrementMustBeNumber, "", 0, 0, false},
+		{"incrby key 99999999999999999999;", ErrIncrementMustBeNumber, "", 0, 0, false},
+		{"incrbyfloat key ten;", ErrIncrementMustBeNumber, "", 0, 0, false},
+		{"incr cas;", nil, "cas", 1, 0, false},
+		{"incrbyfloat key incr;", ErrIncrementMustBeNumber, "", 0, 0, false},
+	}
+	for i, test := range tests {
+		s, err := parseSingleStatement(test.statement)
+		if err != test.err {
+			t.Errorf("Test %d failed: expected error '%s', got '%s'", i+1, test.err, err)
+		}
+		if test.err != nil {
+			continue
+		}
+		statement, ok := s.(*IncrStatement)
+		if !ok {
+			t.Errorf("Test %d failed: Expected an IncrStatement, got a %T", i+1, s)
+			continue
+		}
+		if statement.Key() != test.key || statement.By() != test.by || statement.ByFloat() != test.byFloat || statement.Float() != test.float {
+			t.Errorf("Test %d failed: Expected %s by %d/%f (%t), got %s by %d/%f (%t)", i+1, test.key, test.by, test.byFloat, test.float,
+				statement.Key(), statement.By(), statement.ByFloat(), statement.Float())
+		}
+	}
+}
+
+func TestParserUpdateStatements(t *testing.T) {
+	fmt.Println("-- TestParserUpdateStatements")
+	tests := []struct {
+		statement string
+		err       error
+		command   TokenType
+		key       string
+		value     string
+	}{
+		{"append key value;", nil, APPEND, "key", "value"},
+		{"getset key value", nil, GETSET, "key", "value"},
+		{"setnx key 10;", nil, SETNX, "key", "10"},
+		{"setxx key 1.5;", nil, SETXX, "key", "1.5"},
+		{"append append setnx;", nil, APPEND, "append", "setnx"},
+		{"append key;", ErrWrongNumberOfArguments, 0, "", ""},
+		{"setnx key value value;", ErrWrongNumberOfArguments, 0, "", ""},
+		{"getset key (value);", ErrUnknownToken, 0, "", ""},
+	}
+	for i, test := range tests {
+		s, err := parseSingleStatement(test.statement)
+		if err != test.err {
+			t.Errorf("Test %d failed: expected error '%s', got '%s'", i+1, test.err, err)
+		}
+		if test.err != nil {
+			continue
+		}
+		statement, ok := s.(*UpdateStatement)
+		if !ok {
+			t.Errorf("Test %d failed: Expected an UpdateStatement, got a %T", i+1, s)
+			continue
+		}
+		if statement.Command() != test.command || statement.Key() != test.key || statement.Value() != test.value {
+			t.Errorf("Test %d failed: Expected %s %s %s, got %s %s %s", i+1, test.command, test.key, test.value,
+				statement.Command(), statement.Key(), statement.Value())
+		}
+	}
+}
+
+func TestParserCASStatement(t *testing.T) {
+	fmt.Println("-- TestParserCASStatement")
+	tests := []struct {
+		statement string
+		err       error
+		key       string
+		old, new  string
+	}{
+		{"cas key old new;", nil, "key", "old", "new"},
+		{"cas key 1 2", nil, "key", "1", "2"},
+		{"cas cas incr getset;", nil, "cas", "incr", "getset"},
+		{"cas key old;", ErrWrongNumberOfArguments, "", "", ""},
+		{"cas key old new newer;", ErrWrongNumberOfArguments, "", "", ""},
+	}
+	for i, test := range tests {
+		s, err := parseSingleStatement(test.statement)
+		if err != test.err {
+			t.Errorf("Test %d failed: expected error '%s', got '%s'", i+1, test.err, err)
+		}
+		if test.err != nil {
+			continue
+		}
+		statement, ok := s.(*CASStatement)
+		if !ok {
+			t.Errorf("Test %d failed: Expected a CASStatement, got a %T", i+1, s)
+			continue
+		}
+		if statement.Key() != test.key || statement.Old() != test.old || statement.New() != test.new {
+			t.Errorf("Test %d failed: Expected %s %s->%s, got %s %s->%s", i+1, test.key, test.old, test.new,
+				statement.Key(), statement.Old(), statement.New())
+		}
+	}
+}
+
+func TestParserExpireStatements(t *testing.T) {
+	fmt.Println("-- TestParserExpireStatements")
+	tests := []struct {
+		statement string
+		err       error
+		command   TokenType
+		key       string
+		ms        int64
+	}{
+		{"expire key 1000;", nil, EXPIRE, "key", 1000},
+		{"expire key -1", nil, EXPIRE, "key", -1},
+		{"expireat key 1700000000000;", nil, EXPIREAT, "key", 1700000000000},
+		{"persist key;", nil, PERSIST, "key", 0},
+		{"expire key;", ErrWrongNumberOfArguments, 0, "", 0},
+		{"expire key 1.5;", ErrExpirationMustBeInteger, 0, "", 0},
+		{"expireat key soon;", ErrExpirationMustBeInteger, 0, "", 0},
+		{"persist key 10;", ErrWrongNumberOfArguments, 0, "", 0},
+		{"expire ttl 10;", nil, EXPIRE, "ttl", 10},
+		{"persist persist;", nil, PERSIST, "persist", 0},
+	}
+	for i, test := range tests {
+		s, err := parseSingleStatement(test.statement)
+		if err != test.err {
+			t.Errorf("Test %d failed: expected error '%s', got '%s'", i+1, test.err, err)
+		}
+		if test.err != nil {
+			continue
+		}
+		statement, ok := s.(*ExpireStatement)
+		if !ok {
+			t.Errorf("Test %d failed: Expected an ExpireStatement, got a %T", i+1, s)
+			continue
+		}
+		if statement.Command() != test.command || statement.Key() != test.key || statement.Milliseconds() != test.ms {
+			t.Errorf("Test %d failed: Expected %s %s %d, got %s %s %d", i+1, test.command, test.key, test.ms,
+				statement.Command(), statement.Key(), statement.Milliseconds())
+		}
+	}
+}
+
+func TestParserTTLStatement(t *testing.T) {
+	fmt.Println("-- TestParserTTLStatement")
+	tests := []struct {
+		statement string
+		err       error
+		key       string
+	}{
+		{"ttl key;", nil, "key"},
+		{"ttl key", nil, "key"},
+		{"ttl ttl;", nil, "ttl"},
+		{"ttl expireat", nil, "expireat"},
+		{"ttl;", ErrWrongNumberOfArguments, ""},
+		{"ttl key1 key2;", ErrWrongNumberOfArguments, ""},
+	}
+	for i, test := range tests {
+		s, err := parseSingleStatement(test.statement)
+		if err != test.err {
+			t.Errorf("Test %d failed: expected error '%s', got '%s'", i+1, test.err, err)
+		}
+		if test.err != nil {
+			continue
+		}
+		statement, ok := s.(*TTLStatement)
+		if !ok {
+			t.Errorf("Test %d failed: Expected a TTLStatement, got a %T", i+1, s)
+			continue
+		}
+		if statement.Key() != test.key {
+			t.Errorf("Test %d failed: Expected key %s, got %s", i+1, test.key, statement.Key())
+		}
+	}
+}
+
+func TestParserMultipleStatements(t *testing.T) {
+	fmt.Println("-- TestParserMultipleStatements")
+	tests := []struct {
+		statement string
+		expected  []string
+	}{
+		{"get key; set key value;", []string{"*ql.GetStatement", "*ql.SetStatement"}},
+		{"get cas; incr cas;", []string{"*ql.GetStatement", "*ql.IncrStatement"}},
+		{"del key; get key", []string{"*ql.DelStatement", "*ql.GetStatement"}},
+		{"set key value; cas key value other;", []string{"*ql.SetStatement", "*ql.CASStatement"}},
+	}
+	for i, test := range tests {
+		statements, err := Parse(test.statement)
+		if err != nil {
+			t.Errorf("Test %d failed: unexpected error '%s'", i+1, err)
+			continue
+		}
+		var types []string
+		for _, s := range statements {
+			types = append(types, fmt.Sprintf("%T", s))
+		}
+		if fmt.Sprint(types) != fmt.Sprint(test.expected) {
+			t.Errorf("Test %d failed: expected statements %v, got %v", i+1, test.expected, types)
+		}
+	}
+}
+
 func parseSingleStatement(statement string) (Statement, error) {
 	l, _ := NewLexer(statement)
 	s, err := NewParser(l).Parse()
@@ -28,6 +28,11 @@ func (tt TokenType) notEquals(other TokenType) bool {
 	return tt != other
 }
 
+// isWord tells you if the token is an identifier or a keyword, either of which can be a key or a value
+func (tt TokenType) isWord() bool {
+	return tt == IDENTIFIER || tt >= SELECT && tt <= DESC
+}
+
 // Token represents something in a query
 type Token struct {
 	raw       []byte
@@ -39,6 +44,10 @@ func NewToken(t TokenType) Token {
 	return Token{tokenIndex[t], t}
 }
 
+func (t *Token) isWord() bool {
+	return t.tokenType.isWord()
+}
+
 func (t Token) String() string {
 	if t.raw == nil {
 		return ""
@@ -49,6 +58,7 @@ func (t Token) String() string {
 const (
 	IDENTIFIER TokenType = iota
 
+	// keywords, everything from SELECT to DESC, are words a key or a value can also be
 	SELECT
 	FROM
 	WHERE
@@ -61,6 +71,18 @@ const (
 	DEL
 	SET
 	EXISTS
+	INCR
+	INCRBY
+	INCRBYFLOAT
+	APPEND
+	GETSET
+	SETNX
+	SETXX
+	CAS
+	EXPIRE
+	EXPIREAT
+	PERSIST
+	TTL
 
 	GT
 	GTE
@@ -77,6 +99,7 @@ const (
 	LPAREN
 
 	INTEGER
+	FLOAT
 
 	// EOQ - End of Query
 	EOQ
@@ -100,6 +123,20 @@ func init() {
 		"set":    SET,
 		"exsits": EXISTS,
 
+		"incr":        INCR,
+		"incrby":      INCRBY,
+		"incrbyfloat": INCRBYFLOAT,
+		"append":      APPEND,
+		"getset":      GETSET,
+		"setnx":       SETNX,
+		"setxx":       SETXX,
+		"cas":         CAS,
+
+		"expire":   EXPIRE,
+		"expireat": EXPIREAT,
+		"persist":  PERSIST,
+		"ttl":      TTL,
+
 		"use":    USE,
 		"index":  INDEX,
 		"bucket": BUCKET,
@@ -119,6 +156,7 @@ func init() {
 		")": RPAREN,
 
 		"INTEGER": INTEGER,
+		"FLOAT":   FLOAT,
 
 		"":        EOQ,
 		"ILLEGAL": ILLEGAL,
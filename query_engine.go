@@ -1,6 +1,13 @@
 package xisdb
 
-import "github.com/alexsward/xisdb/ql"
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/alexsward/xisdb/ql"
+)
 
 // QueryEngine is the processor of xisql statements
 type QueryEngine struct {
@@ -10,14 +17,29 @@ type QueryEngine struct {
 type QueryEngineContext struct {
 	DB      *DB
 	Results chan Item
+	Context context.Context // cancels the query, releasing its transaction, defaults to context.Background()
 	// errors  chan<- error
 }
 
+// send sends the item to the results, unless the query is cancelled first
+func (ctx *QueryEngineContext) send(tx *Tx, item Item) error {
+	select {
+	case ctx.Results <- item:
+		return nil
+	case <-tx.Context().Done():
+		return tx.Context().Err()
+	}
+}
+
 // Execute will perform all of the statements in the context of the QueryEngineContext
 func (qe *QueryEngine) Execute(statements []ql.Statement, ctx *QueryEngineContext) error {
 	if ctx.DB == nil {
 		return ErrNoDatabase
 	}
+	c := ctx.Context
+	if c == nil {
+		c = context.Background()
+	}
 
 	go func() error {
 		defer close(ctx.Results)
@@ -29,41 +51,168 @@ func (qe *QueryEngine) Execute(statements []ql.Statement, ctx *QueryEngineContex
 			switch statement.(type) {
 			case *ql.GetStatement:
 				s := statement.(*ql.GetStatement)
-				for _, key := range s.Keys() {
-					item, err := ctx.DB.Get(key)
+				return ctx.DB.ReadContext(c, func(tx *Tx) error {
+					for _, key := range s.Keys() {
+						item, err := tx.Get(key)
+						if err != nil {
+							return err
+						}
+						if err := ctx.send(tx, Item{key, item, nil}); err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+			case *ql.SelectStatement:
+				s := statement.(*ql.SelectStatement)
+				return ctx.DB.ReadContext(c, func(tx *Tx) error {
+					items, err := query(tx, s)
 					if err != nil {
 						return err
 					}
-					ctx.Results <- Item{key, item, nil}
-				}
-				return nil
+					for item := range items {
+						if err := ctx.send(tx, item); err != nil {
+							return err
+						}
+					}
+					return nil
+				})
 			case *ql.SetStatement:
 				s := statement.(*ql.SetStatement)
-				return ctx.DB.ReadWrite(func(tx *Tx) error {
+				var metadata *SetMetadata
+				if s.TTL() > 0 {
+					metadata = &SetMetadata{TTL: s.TTL()}
+				}
+				return ctx.DB.ReadWriteContext(c, func(tx *Tx) error {
 					for key, value := range s.Pairs() {
-						err := tx.Set(key, value, nil)
+						err := tx.Set(key, value, metadata)
 						if err != nil {
 							return err
 						}
-						ctx.Results <- Item{key, value, nil}
+						if err := ctx.send(tx, Item{key, value, nil}); err != nil {
+							return err
+						}
 					}
 					return nil
 				})
 			case *ql.DelStatement:
 				s := statement.(*ql.DelStatement)
-				return ctx.DB.ReadWrite(func(tx *Tx) error {
+				return ctx.DB.ReadWriteContext(c, func(tx *Tx) error {
 					for _, key := range s.Keys() {
 						_, err := tx.Delete(key)
 						if err != nil {
 							return err
 						}
-						ctx.Results <- Item{key, "", nil}
+						if err := ctx.send(tx, Item{key, "", nil}); err != nil {
+							return err
+						}
 					}
 					return nil
 				})
+			case *ql.TTLStatement:
+				s := statement.(*ql.TTLStatement)
+				return ctx.DB.ReadContext(c, func(tx *Tx) error {
+					ttl, err := tx.TTL(s.Key())
+					if err != nil {
+						return err
+					}
+					ms := int64(ttl)
+					if ttl != NoTTL {
+						ms = int64(ttl / time.Millisecond)
+					}
+					return ctx.send(tx, Item{s.Key(), strconv.FormatInt(ms, 10), nil})
+				})
+			case *ql.IncrStatement, *ql.UpdateStatement, *ql.CASStatement, *ql.ExpireStatement:
+				return ctx.DB.ReadWriteContext(c, func(tx *Tx) error {
+					item, err := update(tx, statement)
+					if err != nil {
+						return err
+					}
+					return ctx.send(tx, item)
+				})
 			}
 		}
 		return nil
 	}()
 	return nil
 }
+
+// query finds the items a SELECT asks for, in its index's order if it uses one, otherwise in the
+// order of their keys, up to its limit
+func query(tx *Tx, s *ql.SelectStatement) (<-chan Item, error) {
+	name := ""
+	if len(s.Buckets()) > 0 {
+		name = s.Buckets()[0]
+	}
+	b, exists := tx.db.bucket(name)
+	if !exists {
+		return nil, ErrBucketDoesNotExist
+	}
+	if len(s.Indexes()) > 0 {
+		return tx.iterate(b, s.Indexes()[0], s.Limit)
+	}
+
+	var keys []string
+	for _, item := range b.items(tx.snapshot()) {
+		keys = append(keys, item.Key)
+	}
+	sort.Strings(keys)
+	return buffered(tx.resolve(b, keys, s.Limit)), nil
+}
+
+// update performs one of the atomic statements, giving back the key with the statement's result:
+// the new value for INCR, the new length for APPEND, the old value for GETSET, whether or not
+// the key was set for SETNX, SETXX and CAS, and whether or not it exists for EXPIRE, EXPIREAT
+// and PERSIST
+func update(tx *Tx, statement ql.Statement) (Item, error) {
+	var result string
+	var err error
+	switch s := statement.(type) {
+	case *ql.IncrStatement:
+		if s.Float() {
+			var f float64
+			f, err = tx.IncrByFloat(s.Key(), s.ByFloat())
+			result = strconv.FormatFloat(f, 'f', -1, 64)
+		} else {
+			var n int64
+			n, err = tx.IncrBy(s.Key(), s.By())
+			result = strconv.FormatInt(n, 10)
+		}
+		return Item{s.Key(), result, nil}, err
+	case *ql.UpdateStatement:
+		var set bool
+		switch s.Command() {
+		case ql.APPEND:
+			var n int
+			n, err = tx.Append(s.Key(), s.Value())
+			return Item{s.Key(), strconv.Itoa(n), nil}, err
+		case ql.GETSET:
+			result, _, err = tx.GetSet(s.Key(), s.Value())
+			return Item{s.Key(), result, nil}, err
+		case ql.SETNX:
+			set, err = tx.SetNX(s.Key(), s.Value())
+		case ql.SETXX:
+			set, err = tx.SetXX(s.Key(), s.Value())
+		default:
+			return Item{}, ql.ErrUnsupportedStatement
+		}
+		return Item{s.Key(), strconv.FormatBool(set), nil}, err
+	case *ql.CASStatement:
+		set, err := tx.CompareAndSwap(s.Key(), s.Old(), s.New())
+		return Item{s.Key(), strconv.FormatBool(set), nil}, err
+	case *ql.ExpireStatement:
+		var exists bool
+		switch s.Command() {
+		case ql.EXPIRE:
+			exists, err = tx.Expire(s.Key(), time.Duration(s.Milliseconds())*time.Millisecond)
+		case ql.EXPIREAT:
+			exists, err = tx.ExpireAt(s.Key(), time.Unix(0, s.Milliseconds()*int64(time.Millisecond)))
+		case ql.PERSIST:
+			exists, err = tx.Persist(s.Key())
+		default:
+			return Item{}, ql.ErrUnsupportedStatement
+		}
+		return Item{s.Key(), strconv.FormatBool(exists), nil}, err
+	}
+	return Item{}, ql.ErrUnsupportedStatement
+}
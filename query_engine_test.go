@@ -1,10 +1,12 @@
 package xisdb
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
 
+	"github.com/alexsward/xisdb/indexes"
 	"github.com/alexsward/xisdb/ql"
 )
 
@@ -14,7 +16,7 @@ func TestQueryEngineExecuteGet(t *testing.T) {
 	db.Set("key", "value")
 	ch := make(chan Item, 0)
 	qe := QueryEngine{}
-	err := qe.Execute([]ql.Statement{createSimpleGet("key")}, &QueryEngineContext{db, ch})
+	err := qe.Execute([]ql.Statement{createSimpleGet("key")}, &QueryEngineContext{DB: db, Results: ch})
 	if err != nil {
 		t.Errorf("Test failed. Error executing statemnt: %s", err)
 		return
@@ -22,6 +24,95 @@ func TestQueryEngineExecuteGet(t *testing.T) {
 	time.Sleep(time.Millisecond * 50)
 }
 
+func TestQueryEngineCancel(t *testing.T) {
+	fmt.Println("-- TestQueryEngineCancel")
+	db := openTestDB()
+	ctx, cancel := context.WithCancel(context.Background())
+	statements, _ := ql.Parse("set key value;")
+	qe := QueryEngine{}
+	// nothing receives the results, so the query holds its transaction open until it's cancelled
+	qe.Execute(statements, &QueryEngineContext{DB: db, Results: make(chan Item), Context: ctx})
+	cancel()
+
+	done := make(chan error)
+	go func() {
+		done <- db.Set("other", "value")
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Error writing after the query was cancelled: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected a cancelled query to release its transaction")
+	}
+	if exists, _ := db.Exists("key"); exists {
+		t.Errorf("Expected the cancelled query to be rolled back")
+	}
+}
+
+func TestQueryEngineSelect(t *testing.T) {
+	fmt.Println("-- TestQueryEngineSelect")
+	db := openTestDB()
+	for _, key := range []string{"user:b", "order:1", "user:a", "user:c"} {
+		db.Set(key, "value")
+	}
+	db.CreateIndex(IndexDefinition{Name: "users", Matcher: indexes.Prefix("user:"), Comparator: indexes.ReverseOrder})
+	db.ReadWrite(func(tx *Tx) error {
+		b, _ := tx.Bucket("things")
+		b.Set("key2", "value")
+		b.Set("key1", "value")
+		return nil
+	})
+	tests := []struct {
+		statement string
+		expected  []string
+	}{
+		{"select;", []string{"order:1", "user:a", "user:b", "user:c"}},
+		{"select limit 2;", []string{"order:1", "user:a"}},
+		{"select use index users;", []string{"user:c", "user:b", "user:a"}},
+		{"select use index users limit 1;", []string{"user:c"}},
+		{"select use index missing;", nil},
+		{"select from bucket things;", []string{"key1", "key2"}},
+		{"select from bucket missing;", nil},
+		{"select use index users index2;", nil},
+	}
+	for i, test := range tests {
+		statements, err := ql.Parse(test.statement)
+		if err != nil {
+			t.Errorf("Test %d failed: error parsing '%s': %s", i+1, test.statement, err)
+			continue
+		}
+		keys, err := queryKeys(db, statements)
+		if err != nil {
+			t.Errorf("Test %d failed: %s", i+1, err)
+			continue
+		}
+		if fmt.Sprint(keys) != fmt.Sprint(test.expected) {
+			t.Errorf("Test %d failed: expected keys %v, got %v", i+1, test.expected, keys)
+		}
+	}
+}
+
+// queryKeys executes the statements, returning the keys of every result
+func queryKeys(db *DB, statements []ql.Statement) ([]string, error) {
+	ch := make(chan Item)
+	qe := QueryEngine{}
+	qe.Execute(statements, &QueryEngineContext{DB: db, Results: ch})
+	var keys []string
+	for {
+		select {
+		case item, ok := <-ch:
+			if !ok {
+				return keys, nil
+			}
+			keys = append(keys, item.Key)
+		case <-time.After(time.Second):
+			return keys, fmt.Errorf("timed out waiting for results")
+		}
+	}
+}
+
 func createSimpleGet(key string) ql.Statement {
 	s, _ := ql.Parse(fmt.Sprintf("get %s;", key))
 	return s[0]
@@ -0,0 +1,145 @@
+package xisdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// Every record in the database file is framed by a fixed size header: a magic
+// number marking the start of a record, the length of the record and a CRC of
+// both the length and the record itself. The magic number lets a reader find
+// the next intact record after a corrupted one
+const (
+	recordMagic      uint32 = 0x78697372 // "xisr"
+	recordHeaderSize        = 12
+)
+
+var (
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+	// errCorruptRecord when a record fails validation, meaning it's either torn or corrupted
+	errCorruptRecord = errors.New("Corrupt record")
+)
+
+// frameRecord prefixes the record with its header so it can be validated when read back
+func frameRecord(record []byte) []byte {
+	framed := make([]byte, recordHeaderSize, recordHeaderSize+len(record))
+	binary.LittleEndian.PutUint32(framed[0:4], recordMagic)
+	binary.LittleEndian.PutUint32(framed[4:8], uint32(len(record)))
+	binary.LittleEndian.PutUint32(framed[8:12], recordChecksum(framed[4:8], record))
+	return append(framed, record...)
+}
+
+func recordChecksum(length, record []byte) uint32 {
+	return crc32.Update(crc32.Checksum(length, crcTable), crcTable, record)
+}
+
+// recordReader reads framed records from the database file
+type recordReader struct {
+	file   io.ReaderAt
+	size   int64
+	offset int64 // where the next record starts
+	r      *bufio.Reader
+}
+
+func newRecordReader(file io.ReaderAt, offset, size int64) *recordReader {
+	rr := &recordReader{file: file, size: size}
+	rr.seek(offset)
+	return rr
+}
+
+func (rr *recordReader) seek(offset int64) {
+	rr.offset = offset
+	rr.r = bufio.NewReader(io.NewSectionReader(rr.file, offset, rr.size-offset))
+}
+
+// next reads the record at the current offset, moving past it. Returns io.EOF
+// when there are no records left and errCorruptRecord if the record is invalid,
+// in which case the reader doesn't move
+func (rr *recordReader) next() ([]byte, error) {
+	if rr.offset >= rr.size {
+		return nil, io.EOF
+	}
+
+	record, err := rr.read()
+	if err != nil {
+		rr.seek(rr.offset)
+		return nil, err
+	}
+	rr.offset += int64(recordHeaderSize + len(record))
+	return record, nil
+}
+
+func (rr *recordReader) read() ([]byte, error) {
+	return readFrame(rr.r, rr.size-rr.offset)
+}
+
+// readFrame reads a framed record from r, which has remaining bytes left or < 0 if that's unknown.
+// Returns io.EOF if r is already at its end, otherwise errCorruptRecord for anything invalid
+func readFrame(r io.Reader, remaining int64) ([]byte, error) {
+	var header [recordHeaderSize]byte
+	if n, err := io.ReadFull(r, header[:]); err != nil {
+		if n == 0 && err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, errCorruptRecord
+	}
+	if binary.LittleEndian.Uint32(header[0:4]) != recordMagic {
+		return nil, errCorruptRecord
+	}
+
+	length := int64(binary.LittleEndian.Uint32(header[4:8]))
+	var record []byte
+	if remaining >= 0 {
+		if length > remaining-recordHeaderSize {
+			return nil, errCorruptRecord
+		}
+		record = make([]byte, length)
+		if _, err := io.ReadFull(r, record); err != nil {
+			return nil, errCorruptRecord
+		}
+	} else {
+		// the length can't be trusted until the checksum is, so don't allocate all of it up front
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, r, length); err != nil {
+			return nil, errCorruptRecord
+		}
+		record = buf.Bytes()
+	}
+
+	if binary.LittleEndian.Uint32(header[8:12]) != recordChecksum(header[4:8], record) {
+		return nil, errCorruptRecord
+	}
+	return record, nil
+}
+
+// resync finds the next intact record after a corrupted one at the current offset,
+// and positions the reader at it. Returns false if there are none in the rest of the file
+func (rr *recordReader) resync() bool {
+	start := rr.offset
+	scan := bufio.NewReader(io.NewSectionReader(rr.file, start+1, rr.size-start-1))
+	var magic [4]byte
+	binary.LittleEndian.PutUint32(magic[:], recordMagic)
+
+	for offset := start + 1; offset+recordHeaderSize <= rr.size; offset++ {
+		peek, err := scan.Peek(len(magic))
+		if err != nil {
+			break
+		}
+		if string(peek) == string(magic[:]) {
+			rr.seek(offset)
+			if _, err := rr.read(); err == nil {
+				rr.seek(offset)
+				return true
+			}
+		}
+		scan.Discard(1)
+	}
+
+	rr.seek(start)
+	return false
+}
@@ -0,0 +1,74 @@
+package xisdb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestRecordsReadFramed(t *testing.T) {
+	fmt.Println("-- TestRecordsReadFramed")
+	records := [][]byte{[]byte("first"), {}, []byte("third record")}
+	var file []byte
+	for _, r := range records {
+		file = append(file, frameRecord(r)...)
+	}
+
+	rr := newRecordReader(bytes.NewReader(file), 0, int64(len(file)))
+	for i, expected := range records {
+		record, err := rr.next()
+		if err != nil {
+			t.Fatalf("Record %d: unexpected error '%s'", i+1, err)
+		}
+		if !bytes.Equal(record, expected) {
+			t.Errorf("Record %d: expected '%s', got '%s'", i+1, expected, record)
+		}
+	}
+	if _, err := rr.next(); err != io.EOF {
+		t.Errorf("Expected io.EOF after the last record, got '%s'", err)
+	}
+}
+
+func TestRecordsCorrupt(t *testing.T) {
+	fmt.Println("-- TestRecordsCorrupt")
+	first, second := frameRecord([]byte("first")), frameRecord([]byte("second"))
+	tests := []struct {
+		file   []byte
+		resync bool
+	}{
+		{first[:len(first)-1], false},                                     // torn
+		{append(append([]byte{}, first[:recordHeaderSize]...), 0), false}, // torn
+		{append(append([]byte("garbage"), first...), second...), true},    // garbage before
+		{append(corrupt(first, recordHeaderSize), second...), true},       // bad checksum
+		{append(corrupt(first, 5), second...), true},                      // bad length
+		{corrupt(first, 0), false},                                        // bad magic
+	}
+	for i, test := range tests {
+		rr := newRecordReader(bytes.NewReader(test.file), 0, int64(len(test.file)))
+		if _, err := rr.next(); err != errCorruptRecord {
+			t.Errorf("Test %d failed: expected error '%s', got '%s'", i+1, errCorruptRecord, err)
+			continue
+		}
+		if rr.offset != 0 {
+			t.Errorf("Test %d failed: expected reader to stay at the corrupt record, it moved to %d", i+1, rr.offset)
+		}
+		if rr.resync() != test.resync {
+			t.Errorf("Test %d failed: expected resync %t, got %t", i+1, test.resync, !test.resync)
+			continue
+		}
+		if !test.resync {
+			continue
+		}
+		record, err := rr.next()
+		if err != nil || len(record) == 0 {
+			t.Errorf("Test %d failed: expected an intact record after resync, got '%s' with error '%s'", i+1, record, err)
+		}
+	}
+}
+
+func corrupt(b []byte, at int) []byte {
+	c := append([]byte{}, b...)
+	c[at] ^= 0xff
+	return c
+}
@@ -0,0 +1,139 @@
+package xisdb
+
+import (
+	"math"
+	"time"
+)
+
+// OpenAt opens the database as it was at time t, replaying only the transactions in its storage
+// committed up to then. It's always opened read-only, since anything written would follow
+// transactions that were left out; use RestoreTo to bring back an earlier state for writing.
+// Compaction discards history, so t can't be before the storage was last compacted
+func OpenAt(opts *Options, t time.Time) (*DB, error) {
+	if opts.InMemory && opts.Storage == nil {
+		return nil, ErrDatabaseNotPersistent
+	}
+
+	o := *opts
+	o.ReadOnly = true
+	return open(&o, restorePoint(t))
+}
+
+// RestoreTo returns the database to how it was at time t. The storage is replayed up to
+// then, and whatever changes are needed to get back to that state are committed as a single
+// transaction. Nothing is lost: the transactions after t are still stored, so a later restore
+// can undo this one. Compaction discards history, so t can't be before the storage was last
+// compacted
+func (db *DB) RestoreTo(t time.Time) error {
+	if db.storage == nil {
+		return ErrDatabaseNotPersistent
+	}
+
+	return db.ReadWrite(func(tx *Tx) error {
+		restored, err := db.replay(restorePoint(t))
+		if err != nil {
+			return err
+		}
+		return tx.restore(restored.buckets)
+	})
+}
+
+// restorePoint is the id of the last transaction committed by time t. Ids are unix nanosecond
+// timestamps, so times too far off to be one are before or after every transaction
+func restorePoint(t time.Time) int64 {
+	switch {
+	case t.Before(time.Unix(0, math.MinInt64)):
+		return math.MinInt64
+	case t.After(time.Unix(0, math.MaxInt64)):
+		return latest
+	}
+	return t.UnixNano()
+}
+
+// replay rebuilds the database as of transaction id until from its storage, without changing this one
+func (db *DB) replay(until int64) (*DB, error) {
+	replayed := newReplayDB()
+	replayed.fileErrors = db.fileErrors
+	replayed.storage = db.storage
+	replayed.cipher = db.cipher
+	replayed.until = until
+	if err := replayed.load(); err != nil {
+		return nil, err
+	}
+	return replayed, nil
+}
+
+// newReplayDB creates a bare, read-only database that only holds buckets. It's used
+// to rebuild a database that will be restored from
+func newReplayDB() *DB {
+	db := &DB{
+		readOnly: true,
+		buckets:  make(map[string]*bucket),
+		until:    latest,
+	}
+	db.rootBucket = newBucket("", db)
+	db.buckets[""] = db.rootBucket
+	return db
+}
+
+// restore makes every bucket, item and persisted index in the database match the given buckets,
+// only changing what is different between them
+func (tx *Tx) restore(buckets map[string]*bucket) error {
+	for name := range tx.db.buckets {
+		if _, exists := buckets[name]; !exists {
+			if _, err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	for name, source := range buckets {
+		// options can't be changed, so a bucket that had different ones is created again
+		if current, exists := tx.db.buckets[name]; exists && current.options != source.options {
+			if _, err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		b, err := tx.bucket(name, &source.options)
+		if err != nil {
+			return err
+		}
+		for _, item := range b.managed.items(tx.snapshot()) {
+			if !source.exists(item.Key, latest) {
+				if _, err := tx.delete(b.managed, item.Key); err != nil {
+					return err
+				}
+			}
+		}
+		for _, item := range source.items(latest) {
+			current, exists := b.managed.get(item.Key, tx.snapshot())
+			if exists && current.Value == item.Value && current.expiresAt() == item.expiresAt() {
+				continue
+			}
+			tx.insert(b.managed, &Item{item.Key, item.Value, newItemMetadata(item.expiresAt())})
+		}
+		if err := tx.restoreIndexes(b.managed, source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreIndexes makes the persisted indexes in the bucket match those in source. Indexes
+// that aren't persisted are left alone, unless one in source has the same name
+func (tx *Tx) restoreIndexes(b, source *bucket) error {
+	for name, idx := range b.indexes {
+		if idx.definition != nil && !source.hasIndex(name, idx.definition) {
+			tx.deleteIndex(b, name)
+		}
+	}
+	for name, idx := range source.indexes {
+		if idx.definition == nil || b.hasIndex(name, idx.definition) {
+			continue
+		}
+		if err := tx.createIndex(b, idx.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
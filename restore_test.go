@@ -0,0 +1,200 @@
+package xisdb
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setAndGetID sets a key and returns the id of the transaction that did it
+func setAndGetID(db *DB, key, value string) int64 {
+	var id int64
+	db.ReadWrite(func(tx *Tx) error {
+		id = tx.ID()
+		return tx.Set(key, value, nil)
+	})
+	return id
+}
+
+func TestRestoreOpenAt(t *testing.T) {
+	fmt.Println("-- TestRestoreOpenAt")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db := openTestFileDB(t, filename)
+	first := setAndGetID(db, "key", "value1")
+	db.Bucket("b1")
+	second := setAndGetID(db, "key", "value2")
+	db.Delete("key")
+	db.Close()
+
+	tests := []struct {
+		at            int64
+		value         string
+		exists, found bool
+	}{
+		{first - 1, "", false, false},
+		{first, "value1", true, false},
+		{second, "value2", true, true},
+		{time.Now().UnixNano(), "", false, true},
+	}
+	for i, test := range tests {
+		db, err := OpenAt(&Options{Filename: filename, BackgroundInterval: -1}, time.Unix(0, test.at))
+		if err != nil {
+			t.Errorf("Test %d failed: error opening database: %s", i+1, err)
+			continue
+		}
+		value, err := db.Get("key")
+		if test.exists && value != test.value {
+			t.Errorf("Test %d failed: expected value '%s', got '%s' (%v)", i+1, test.value, value, err)
+		}
+		if !test.exists && err != ErrKeyNotFound {
+			t.Errorf("Test %d failed: expected key to not exist, got '%s'", i+1, value)
+		}
+		assertBucketExists(t, db, "b1", test.found)
+		if err := db.Set("key", "value"); err != ErrDatabaseReadOnly {
+			t.Errorf("Test %d failed: expected error '%s' writing, got '%s'", i+1, ErrDatabaseReadOnly, err)
+		}
+		db.Close()
+	}
+}
+
+func TestRestoreTo(t *testing.T) {
+	fmt.Println("-- TestRestoreTo")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db := openTestFileDB(t, filename)
+	setAndGetID(db, "kept", "value")
+	restorePoint := setAndGetID(db, "key", "good")
+	db.Set("key", "garbage")
+	db.Set("other", "garbage")
+	db.Bucket("b1")
+	last := setAndGetID(db, "kept", "changed")
+
+	if err := db.RestoreTo(time.Unix(0, restorePoint)); err != nil {
+		t.Fatalf("Error restoring database: %s", err)
+	}
+	assertDBKeyValue(t, db, "key", "good", true)
+	assertDBKeyValue(t, db, "kept", "value", true)
+	assertBucketExists(t, db, "b1", false)
+	if exists, _ := db.Exists("other"); exists {
+		t.Errorf("Expected key written after the restore point to not exist")
+	}
+	db.Close()
+
+	db = openTestFileDB(t, filename)
+	defer db.Close()
+	assertDBKeyValue(t, db, "key", "good", true)
+	assertBucketExists(t, db, "b1", false)
+
+	// the restore itself can be undone
+	if err := db.RestoreTo(time.Unix(0, last)); err != nil {
+		t.Fatalf("Error restoring database: %s", err)
+	}
+	assertDBKeyValue(t, db, "key", "garbage", true)
+	assertDBKeyValue(t, db, "kept", "changed", true)
+	assertBucketExists(t, db, "b1", true)
+}
+
+func TestRestoreBeforeFirstTransaction(t *testing.T) {
+	fmt.Println("-- TestRestoreBeforeFirstTransaction")
+	tests := []time.Time{
+		{},
+		time.Unix(0, 0),
+		time.Date(1969, time.July, 20, 0, 0, 0, 0, time.UTC),
+	}
+	for i, at := range tests {
+		filename := filepath.Join(t.TempDir(), "test.data")
+		db := openTestFileDB(t, filename)
+		db.Set("key", "value")
+		db.Bucket("b1")
+		db.Close()
+
+		db, err := OpenAt(&Options{Filename: filename, BackgroundInterval: -1}, at)
+		if err != nil {
+			t.Errorf("Test %d failed: error opening database: %s", i+1, err)
+			continue
+		}
+		if exists, _ := db.Exists("key"); exists {
+			t.Errorf("Test %d failed: expected key to not exist opening the database", i+1)
+		}
+		assertBucketExists(t, db, "b1", false)
+		db.Close()
+
+		db = openTestFileDB(t, filename)
+		if err := db.RestoreTo(at); err != nil {
+			t.Errorf("Test %d failed: error restoring database: %s", i+1, err)
+		}
+		if exists, _ := db.Exists("key"); exists {
+			t.Errorf("Test %d failed: expected key to not exist restoring the database", i+1)
+		}
+		assertBucketExists(t, db, "b1", false)
+		db.Close()
+	}
+}
+
+func TestRestoreVetoed(t *testing.T) {
+	fmt.Println("-- TestRestoreVetoed")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db := openTestFileDB(t, filename)
+	defer db.Close()
+	db.ReadWrite(func(tx *Tx) error {
+		b, _ := tx.Bucket("b1")
+		b.Set("key", "value1")
+		return b.Set("other", "value1")
+	})
+	restorePoint := setAndGetID(db, "root", "value1")
+	db.ReadWrite(func(tx *Tx) error {
+		tx.DeleteBucket("b1")
+		b, _ := tx.BucketWithOptions("b1", BucketOptions{DefaultTTL: time.Hour})
+		b.Set("key", "value2")
+		return b.Set("other", "value2")
+	})
+	db.Set("root", "value2")
+
+	veto := errors.New("veto")
+	db.BeforeCommit(func(changes []Change) error {
+		return veto
+	})
+	if err := db.RestoreTo(time.Unix(0, restorePoint)); err != veto {
+		t.Fatalf("Expected error '%s' restoring, got '%s'", veto, err)
+	}
+
+	// the bucket that had different options, and everything in it, is left as it was
+	assertDBKeyValue(t, db, "root", "value2", true)
+	db.ReadWrite(func(tx *Tx) error {
+		b, _ := tx.Bucket("b1")
+		if opts := b.Options(); opts.DefaultTTL != time.Hour {
+			t.Errorf("Expected the bucket's options to be left alone, got %v", opts)
+		}
+		for _, key := range []string{"key", "other"} {
+			if value, err := b.Get(key); value != "value2" {
+				t.Errorf("Expected key '%s' to be 'value2', got '%s' (%v)", key, value, err)
+			}
+		}
+		return errors.New("rollback")
+	})
+}
+
+func TestRestoreErrors(t *testing.T) {
+	fmt.Println("-- TestRestoreErrors")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db := openTestFileDB(t, filename)
+	before := setAndGetID(db, "key", "value1")
+	db.Set("key", "value2")
+	db.Compact()
+
+	if err := db.RestoreTo(time.Unix(0, before)); err != ErrRestorePointUnavailable {
+		t.Errorf("Expected error '%s' restoring past a compaction, got '%s'", ErrRestorePointUnavailable, err)
+	}
+	db.Close()
+	if _, err := OpenAt(&Options{Filename: filename}, time.Unix(0, before)); err != ErrRestorePointUnavailable {
+		t.Errorf("Expected error '%s' opening past a compaction, got '%s'", ErrRestorePointUnavailable, err)
+	}
+
+	if err := openTestDB().RestoreTo(time.Now()); err != ErrDatabaseNotPersistent {
+		t.Errorf("Expected error '%s' restoring an in-memory database, got '%s'", ErrDatabaseNotPersistent, err)
+	}
+	if _, err := OpenAt(&Options{InMemory: true}, time.Now()); err != ErrDatabaseNotPersistent {
+		t.Errorf("Expected error '%s' opening an in-memory database, got '%s'", ErrDatabaseNotPersistent, err)
+	}
+}
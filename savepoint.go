@@ -0,0 +1,116 @@
+package xisdb
+
+// savepoint marks a point in a write transaction that it can be rolled back to. It keeps undo
+// records of its own, just like the transaction's, of how everything changed since it was made was before
+type savepoint struct {
+	name            string
+	rollbackBuckets map[string]*bucket
+	rollbacks       map[*bucket]*rollbackInfo
+	commits, hooks  int // how many commits and hooks the transaction had when it was made
+}
+
+// Savepoint marks the transaction as it is now by name. Rolling back to it with RollbackTo undoes
+// just what's changed since, without ending the transaction. Savepoints can be made within one
+// another, and a name that's used more than once refers to the newest savepoint with it
+func (tx *Tx) Savepoint(name string) error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	if !tx.write {
+		return ErrNotWriteTransaction
+	}
+
+	tx.savepoint(name)
+	return nil
+}
+
+func (tx *Tx) savepoint(name string) *savepoint {
+	sp := &savepoint{
+		name:            name,
+		rollbackBuckets: make(map[string]*bucket),
+		rollbacks:       make(map[*bucket]*rollbackInfo),
+		commits:         len(tx.commits),
+		hooks:           len(tx.hooks),
+	}
+	tx.savepoints = append(tx.savepoints, sp)
+	return sp
+}
+
+// RollbackTo undoes everything changed since the savepoint, releasing every savepoint made after
+// it. The savepoint itself is kept, so it can be rolled back to again
+func (tx *Tx) RollbackTo(name string) error {
+	sp, err := tx.findSavepoint(name)
+	if err != nil {
+		return err
+	}
+	return tx.rollbackTo(sp)
+}
+
+func (tx *Tx) rollbackTo(sp *savepoint) error {
+	tx.release(sp)
+	tx.savepoints = append(tx.savepoints, sp)
+
+	err := tx.db.undo(sp.rollbackBuckets, sp.rollbacks, tx.version)
+	sp.rollbackBuckets = make(map[string]*bucket)
+	sp.rollbacks = make(map[*bucket]*rollbackInfo)
+	tx.commits = tx.commits[:sp.commits]
+	tx.hooks = tx.hooks[:sp.hooks]
+	return err
+}
+
+// Release forgets the savepoint, and every one made after it, keeping everything changed since
+func (tx *Tx) Release(name string) error {
+	sp, err := tx.findSavepoint(name)
+	if err != nil {
+		return err
+	}
+	tx.release(sp)
+	return nil
+}
+
+// release forgets the savepoint and every one made after it, if it hasn't been already
+func (tx *Tx) release(sp *savepoint) {
+	for i := len(tx.savepoints) - 1; i >= 0; i-- {
+		if tx.savepoints[i] == sp {
+			tx.savepoints = tx.savepoints[:i]
+			return
+		}
+	}
+}
+
+// findSavepoint finds the newest savepoint by name
+func (tx *Tx) findSavepoint(name string) (*savepoint, error) {
+	if err := tx.check(); err != nil {
+		return nil, err
+	}
+	if !tx.write {
+		return nil, ErrNotWriteTransaction
+	}
+
+	for i := len(tx.savepoints) - 1; i >= 0; i-- {
+		if tx.savepoints[i].name == name {
+			return tx.savepoints[i], nil
+		}
+	}
+	return nil, ErrSavepointDoesNotExist
+}
+
+// Nested runs fn as a transaction nested within this one. If fn returns an error, everything it
+// changed is undone and the error is returned, but the transaction carries on; otherwise its changes
+// are kept and become part of the transaction
+func (tx *Tx) Nested(fn func(tx *Tx) error) error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	if !tx.write {
+		return ErrNotWriteTransaction
+	}
+
+	sp := tx.savepoint("")
+	err := fn(tx)
+	if err != nil && tx.check() == nil {
+		err = firstNonNil(tx.rollbackTo(sp), err)
+	}
+	tx.release(sp)
+	return err
+}
@@ -0,0 +1,169 @@
+package xisdb
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestSavepointRollbackTo(t *testing.T) {
+	fmt.Println("-- TestSavepointRollbackTo")
+	db := openTestDB()
+	db.Set("key", "value")
+	db.Set("deleted", "value")
+
+	err := db.ReadWrite(func(tx *Tx) error {
+		tx.Set("kept", "value", nil)
+		tx.Savepoint("first")
+		tx.Set("key", "first", nil)
+		tx.Delete("deleted")
+		b, _ := tx.Bucket("b1")
+		b.Set("bucketkey", "value")
+		tx.Savepoint("second")
+		tx.Set("key", "second", nil)
+		tx.Set("added", "value", nil)
+
+		if err := tx.RollbackTo("second"); err != nil {
+			return err
+		}
+		if value, _ := tx.Get("key"); value != "first" {
+			t.Errorf("Expected value 'first' after rolling back to the second savepoint, got '%s'", value)
+		}
+		if err := tx.RollbackTo("first"); err != nil {
+			return err
+		}
+		if err := tx.RollbackTo("second"); err != ErrSavepointDoesNotExist {
+			t.Errorf("Expected error '%s' rolling back to a released savepoint, got '%v'", ErrSavepointDoesNotExist, err)
+		}
+		// the savepoint is kept, so it can be rolled back to again
+		tx.Set("key", "again", nil)
+		return tx.RollbackTo("first")
+	})
+	if err != nil {
+		t.Fatalf("Error rolling back to savepoints: %s", err)
+	}
+
+	tests := []struct {
+		key, value string
+		exists     bool
+	}{
+		{"key", "value", true},
+		{"deleted", "value", true},
+		{"kept", "value", true},
+		{"added", "", false},
+	}
+	for i, test := range tests {
+		value, err := db.Get(test.key)
+		if test.exists && value != test.value {
+			t.Errorf("Test %d failed: expected '%s' to be '%s', got '%s'", i+1, test.key, test.value, value)
+		}
+		if !test.exists && err != ErrKeyNotFound {
+			t.Errorf("Test %d failed: expected error '%s' getting '%s', got '%v'", i+1, ErrKeyNotFound, test.key, err)
+		}
+	}
+	assertBucketExists(t, db, "b1", false)
+}
+
+func TestSavepointRelease(t *testing.T) {
+	fmt.Println("-- TestSavepointRelease")
+	db := openTestDB()
+	db.Set("key", "value")
+
+	db.ReadWrite(func(tx *Tx) error {
+		tx.Savepoint("outer")
+		tx.Set("key", "outer", nil)
+		tx.Savepoint("inner")
+		tx.Set("key", "inner", nil)
+		if err := tx.Release("inner"); err != nil {
+			t.Errorf("Error releasing savepoint: %s", err)
+		}
+		if err := tx.Release("inner"); err != ErrSavepointDoesNotExist {
+			t.Errorf("Expected error '%s' releasing a savepoint twice, got '%v'", ErrSavepointDoesNotExist, err)
+		}
+		// what was changed after the released savepoint still rolls back with the one before it
+		return tx.RollbackTo("outer")
+	})
+	assertDBKeyValue(t, db, "key", "value", true)
+}
+
+func TestSavepointNested(t *testing.T) {
+	fmt.Println("-- TestSavepointNested")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db := openTestFileDB(t, filename)
+	errBad := errors.New("bad record")
+
+	hooks := 0
+	err := db.ReadWrite(func(tx *Tx) error {
+		for i := 0; i < 5; i++ {
+			err := tx.Nested(func(tx *Tx) error {
+				tx.Hooks(func() { hooks++ })
+				tx.Set(strconv.Itoa(i), "value", nil)
+				if i%2 == 1 {
+					return errBad
+				}
+				return nil
+			})
+			if err != nil && err != errBad {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error importing records: %s", err)
+	}
+	if hooks != 3 {
+		t.Errorf("Expected only the hooks from nested transactions that succeeded to run, %d ran", hooks)
+	}
+	db.Close()
+
+	db = openTestFileDB(t, filename)
+	defer db.Close()
+	for i := 0; i < 5; i++ {
+		exists, _ := db.Exists(strconv.Itoa(i))
+		if exists != (i%2 == 0) {
+			t.Errorf("Expected key '%d' to exist: %t, got %t", i, i%2 == 0, exists)
+		}
+	}
+}
+
+func TestSavepointErrors(t *testing.T) {
+	fmt.Println("-- TestSavepointErrors")
+	db := openTestDB()
+	read := NewTransaction(false, db)
+	closed := NewTransaction(true, db)
+	closed.close()
+	write := NewTransaction(true, db)
+
+	tests := []struct {
+		tx   *Tx
+		name string
+		err  error
+	}{
+		{read, "Savepoint", ErrNotWriteTransaction},
+		{read, "RollbackTo", ErrNotWriteTransaction},
+		{read, "Nested", ErrNotWriteTransaction},
+		{closed, "Savepoint", ErrTxClosed},
+		{closed, "Release", ErrTxClosed},
+		{write, "RollbackTo", ErrSavepointDoesNotExist},
+		{write, "Release", ErrSavepointDoesNotExist},
+	}
+	for i, test := range tests {
+		var err error
+		switch test.name {
+		case "Savepoint":
+			err = test.tx.Savepoint("savepoint")
+		case "RollbackTo":
+			err = test.tx.RollbackTo("savepoint")
+		case "Release":
+			err = test.tx.Release("savepoint")
+		case "Nested":
+			err = test.tx.Nested(func(tx *Tx) error { return nil })
+		}
+		if err != test.err {
+			t.Errorf("Test %d failed: expected error '%s' from %s, got '%v'", i+1, test.err, test.name, err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package xisdb
+
+import "sync/atomic"
+
+const (
+	// snapshotBlockSize is the most commits written to a single snapshot record
+	snapshotBlockSize = 1024
+
+	defaultCompactionRatio   = 2
+	defaultCompactionMinSize = 1 << 20
+)
+
+// A snapshot captures every bucket, item, expiration and persisted index in the database as of
+// the last committed transaction. It's written as snapshot records, each one a
+// block of bucket creations and sets, followed by a record marking its end.
+// All of them carry the id of the last transaction the snapshot includes
+
+// snapshot encodes the entire database as snapshot records. The database must
+// be locked while this happens
+func (db *DB) snapshot() [][]byte {
+	var records [][]byte
+	encodeSnapshot(db.lastID, latest, db.snapshotBuckets(), db.pack, func(record []byte) error {
+		records = append(records, record)
+		return nil
+	})
+	return records
+}
+
+// bucketSnapshot is a bucket as it's written to a snapshot. Its items are versioned, so they can
+// be read once the database is unlocked, but everything else is captured while it's locked
+type bucketSnapshot struct {
+	name    string
+	bucket  *bucket
+	options BucketOptions
+	indexes []*IndexDefinition
+}
+
+// snapshotBuckets captures every bucket in the database. The database must be locked
+func (db *DB) snapshotBuckets() []bucketSnapshot {
+	buckets := make([]bucketSnapshot, 0, len(db.buckets))
+	for name, b := range db.buckets {
+		snapshot := bucketSnapshot{name: name, bucket: b, options: b.options}
+		for _, idx := range b.indexes {
+			if idx.definition != nil {
+				snapshot.indexes = append(snapshot.indexes, idx.definition)
+			}
+		}
+		buckets = append(buckets, snapshot)
+	}
+	return buckets
+}
+
+// encodeSnapshot encodes the buckets, with their items as of version v, as snapshot records of
+// transaction id. Each record is packed and passed to fn as soon as it's complete
+func encodeSnapshot(id, v int64, buckets []bucketSnapshot, pack func([]byte) []byte, fn func(record []byte) error) error {
+	block := make([]*commit, 0, snapshotBlockSize)
+	flush := func(kind byte) error {
+		e := &encoder{}
+		e.record(kind, id, block)
+		block = block[:0]
+		return fn(pack(e.bytes()))
+	}
+	add := func(c *commit) error {
+		block = append(block, c)
+		if len(block) == snapshotBlockSize {
+			return flush(recordSnapshot)
+		}
+		return nil
+	}
+
+	for _, b := range buckets {
+		var commits []*commit
+		if !b.bucket.isRoot() {
+			commits = append(commits, &commit{op: opCreateBucket, bucket: b.name})
+		}
+		if b.options != (BucketOptions{}) {
+			options := b.options
+			commits = append(commits, &commit{op: opBucketOptions, bucket: b.name, options: &options})
+		}
+		for _, item := range b.bucket.items(v) {
+			commits = append(commits, &commit{op: opSet, bucket: b.name, item: item})
+		}
+		for _, def := range b.indexes {
+			commits = append(commits, &commit{op: opCreateIndex, bucket: b.name, index: def})
+		}
+		for _, c := range commits {
+			if err := add(c); err != nil {
+				return err
+			}
+		}
+	}
+	if len(block) > 0 {
+		if err := flush(recordSnapshot); err != nil {
+			return err
+		}
+	}
+	return flush(recordSnapshotEnd)
+}
+
+// Compact replaces everything in the storage with a snapshot of the current data, dropping
+// every overwritten and deleted value from the log. Readers are never blocked, and writers
+// are only blocked while the snapshot is taken in memory, not while it's being stored
+func (db *DB) Compact() error {
+	if db.storage == nil {
+		return nil
+	}
+	if db.readOnly {
+		return ErrDatabaseReadOnly
+	}
+
+	db.compactMutex.Lock()
+	defer db.compactMutex.Unlock()
+	if db.isClosed() {
+		return ErrDatabaseClosed
+	}
+
+	db.lock()
+	snapshot := db.snapshot()
+	appended, size := db.appended, atomic.LoadInt64(&db.size)
+	db.unlock()
+	return db.compact(snapshot, appended, size)
+}
+
+// compact stores the snapshot in place of the records it was taken after: the first appended
+// records, size bytes in all. The compaction mutex must be held
+func (db *DB) compact(snapshot [][]byte, appended, size int64) error {
+	if err := db.storage.Compact(snapshot, appended); err != nil {
+		return err
+	}
+
+	// everything appended while the snapshot was being stored was kept after it, and counts
+	// towards the next compaction
+	var compacted int64
+	for _, record := range snapshot {
+		compacted += int64(len(record))
+	}
+	atomic.AddInt64(&db.size, compacted-size)
+	atomic.StoreInt64(&db.compacted, compacted)
+	return nil
+}
+
+// shouldCompact tells you if the storage has grown enough since it was last compacted
+func (db *DB) shouldCompact() bool {
+	if db.storage == nil || db.compactRatio <= 0 {
+		return false
+	}
+
+	base := atomic.LoadInt64(&db.compacted)
+	if base < db.compactMinSize {
+		base = db.compactMinSize
+	}
+	return float64(atomic.LoadInt64(&db.size)) > db.compactRatio*float64(base)
+}
+
+// compactInBackground starts a compaction unless one is already running
+func (db *DB) compactInBackground() {
+	if !atomic.CompareAndSwapInt32(&db.compacting, 0, 1) {
+		return
+	}
+
+	// writes made while it runs don't start another, so it runs again until it's caught up with
+	// them, as long as it's still making the storage smaller
+	go func() {
+		defer atomic.StoreInt32(&db.compacting, 0)
+		for {
+			size := atomic.LoadInt64(&db.size)
+			if db.Compact() != nil || atomic.LoadInt64(&db.size) >= size || !db.shouldCompact() {
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,167 @@
+package xisdb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func fileSize(t *testing.T, filename string) int64 {
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("Error reading database file %s: %s", filename, err)
+	}
+	return info.Size()
+}
+
+func TestSnapshotCompact(t *testing.T) {
+	fmt.Println("-- TestSnapshotCompact")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db := openTestFileDB(t, filename)
+	for i := 0; i < 100; i++ {
+		db.Set("key", strconv.Itoa(i))
+	}
+	db.ReadWrite(func(tx *Tx) error {
+		b, _ := tx.Bucket("b1")
+		return b.Set("bucketkey", "bucketvalue")
+	})
+	db.ReadWrite(func(tx *Tx) error {
+		return tx.Set("expires", "value", &SetMetadata{TTL: 60000})
+	})
+	before := fileSize(t, filename)
+
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Error compacting database: %s", err)
+	}
+	after := fileSize(t, filename)
+	if after >= before {
+		t.Errorf("Expected compaction to shrink the file from %d bytes, got %d", before, after)
+	}
+
+	db.Set("after", "compaction")
+	db.Close()
+
+	db = openTestFileDB(t, filename)
+	defer db.Close()
+	assertDBKeyValue(t, db, "key", "99", true)
+	assertDBKeyValue(t, db, "after", "compaction", true)
+	assertBucketExists(t, db, "b1", true)
+	if item, exists := db.buckets["b1"].get("bucketkey", latest); !exists || item.Value != "bucketvalue" {
+		t.Errorf("Expected bucketkey in bucket b1 after compaction, got %v", item)
+	}
+	if item, exists := db.root().get("expires", latest); !exists || item.metadata.expiration == nil {
+		t.Errorf("Expected key 'expires' to keep its expiration after compaction")
+	}
+}
+
+func TestSnapshotCompactConcurrentWrites(t *testing.T) {
+	fmt.Println("-- TestSnapshotCompactConcurrentWrites")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db := openTestFileDB(t, filename)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				db.Set(fmt.Sprintf("key-%d", w), strconv.Itoa(i))
+			}
+		}(w)
+	}
+	for i := 0; i < 5; i++ {
+		if err := db.Compact(); err != nil {
+			t.Errorf("Error compacting database: %s", err)
+		}
+	}
+	wg.Wait()
+	db.Close()
+
+	db = openTestFileDB(t, filename)
+	defer db.Close()
+	for w := 0; w < 4; w++ {
+		assertDBKeyValue(t, db, fmt.Sprintf("key-%d", w), "49", true)
+	}
+}
+
+func TestSnapshotAutomaticCompaction(t *testing.T) {
+	fmt.Println("-- TestSnapshotAutomaticCompaction")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db, err := Open(&Options{
+		Filename:           filename,
+		BackgroundInterval: -1,
+		CompactionRatio:    2,
+		CompactionMinSize:  1024,
+	})
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 1000; i++ {
+		db.Set("key", strconv.Itoa(i))
+	}
+	waitForCompaction(t, db)
+	if size := fileSize(t, filename); size > 4096 {
+		t.Errorf("Expected automatic compaction to keep the file small, it's %d bytes", size)
+	}
+}
+
+func TestSnapshotCompactionRatio(t *testing.T) {
+	fmt.Println("-- TestSnapshotCompactionRatio")
+	tests := []struct {
+		ratio float64
+		err   error
+	}{
+		{-1, nil},
+		{0, nil},
+		{0.5, ErrInvalidCompactionRatio},
+		{0.99, ErrInvalidCompactionRatio},
+		{1, nil},
+		{1.5, nil},
+	}
+	for i, test := range tests {
+		db, err := Open(&Options{InMemory: true, BackgroundInterval: -1, CompactionRatio: test.ratio})
+		if err != test.err {
+			t.Errorf("Test %d failed: expected error '%v', got '%v'", i+1, test.err, err)
+		}
+		if err == nil {
+			db.Close()
+		}
+	}
+
+	// with a ratio of 1 a compaction that can't make the file any smaller doesn't run again
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db, err := Open(&Options{Filename: filename, BackgroundInterval: -1, CompactionRatio: 1, CompactionMinSize: 1})
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	defer db.Close()
+	for i := 0; i < 100; i++ {
+		db.Set(strconv.Itoa(i), "value")
+	}
+	waitForCompaction(t, db)
+}
+
+// waitForCompaction waits for a background compaction to finish
+func waitForCompaction(t *testing.T, db *DB) {
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&db.compacting) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the background compaction")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSnapshotCompactInMemory(t *testing.T) {
+	fmt.Println("-- TestSnapshotCompactInMemory")
+	if err := openTestDB().Compact(); err != nil {
+		t.Errorf("Expected compacting an in-memory database to do nothing, got '%s'", err)
+	}
+}
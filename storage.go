@@ -0,0 +1,91 @@
+package xisdb
+
+import "sync"
+
+// Storage is where a database persists its data. Everything is stored as records that are
+// opaque to the storage: every committed write transaction is appended as a single record,
+// and compaction replaces them with the records of a snapshot. The database never calls
+// Append or Compact concurrently with themselves, but everything else can happen alongside
+// them, so implementations must be safe for concurrent use
+type Storage interface {
+	// Load passes every stored record to fn, in order, stopping at the first error it returns.
+	// It's called when the database is opened and again whenever the database is restored to
+	// an earlier point in time, so it must be able to read everything back while open
+	Load(fn func(record []byte) error) (RecoveryReport, error)
+
+	// Append adds a record to the end of the log, flushing it to stable storage before
+	// returning if sync is set. If it fails, nothing can be left appended
+	Append(record []byte, sync bool) error
+
+	// Compact replaces everything stored, up to and including the first n records appended
+	// since the storage was opened, with the records of a snapshot. Any records appended
+	// after those must be kept, following the snapshot
+	Compact(snapshot [][]byte, n int64) error
+
+	// Sync flushes every record appended to stable storage
+	Sync() error
+
+	// Close flushes and releases the storage when the database is closed
+	Close() error
+}
+
+// memoryStorage keeps every record in memory, so it only lasts as long as the process
+type memoryStorage struct {
+	mutex    sync.Mutex
+	records  [][]byte
+	start    int   // index of the first record appended since the storage was opened or last compacted
+	appended int64 // how many records were appended since it was opened, before start
+}
+
+// NewMemoryStorage creates a Storage that keeps everything in memory. A database using it can
+// be restored to an earlier point in time like one using a file, and once it's closed the same
+// storage can be opened again
+func NewMemoryStorage() Storage {
+	return &memoryStorage{}
+}
+
+func (s *memoryStorage) Load(fn func(record []byte) error) (RecoveryReport, error) {
+	s.mutex.Lock()
+	records := s.records
+	s.mutex.Unlock()
+
+	for _, record := range records {
+		if err := fn(record); err != nil {
+			return RecoveryReport{}, err
+		}
+	}
+	return RecoveryReport{}, nil
+}
+
+func (s *memoryStorage) Append(record []byte, sync bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.records = append(s.records, append([]byte{}, record...))
+	return nil
+}
+
+func (s *memoryStorage) Compact(snapshot [][]byte, n int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	kept := s.records[s.start+int(n-s.appended):]
+	records := make([][]byte, 0, len(snapshot)+len(kept))
+	records = append(records, snapshot...)
+	s.records = append(records, kept...)
+	s.start = len(snapshot)
+	s.appended = n
+	return nil
+}
+
+func (s *memoryStorage) Sync() error {
+	return nil
+}
+
+// Close leaves every record in place, so the storage can be opened again as it was
+func (s *memoryStorage) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.start = len(s.records)
+	s.appended = 0
+	return nil
+}
@@ -0,0 +1,87 @@
+package xisdb
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var errStorageFailed = errors.New("Storage failed")
+
+// failingStorage is a memory storage that fails every append after the first few
+type failingStorage struct {
+	Storage
+	appends int
+}
+
+func (s *failingStorage) Append(record []byte, sync bool) error {
+	if s.appends <= 0 {
+		return errStorageFailed
+	}
+	s.appends--
+	return s.Storage.Append(record, sync)
+}
+
+func openTestStorageDB(t *testing.T, storage Storage) *DB {
+	db, err := Open(&Options{Storage: storage, BackgroundInterval: -1, DisableExpiration: true})
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	return db
+}
+
+func TestStorageMemory(t *testing.T) {
+	fmt.Println("-- TestStorageMemory")
+	storage := NewMemoryStorage()
+	db := openTestStorageDB(t, storage)
+	for i := 0; i < 10; i++ {
+		db.Set("key", strconv.Itoa(i))
+	}
+	db.Bucket("b1")
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Error compacting database: %s", err)
+	}
+	restorePoint := setAndGetID(db, "after", "compaction")
+	db.Set("key", "changed")
+	if err := db.RestoreTo(time.Unix(0, restorePoint)); err != nil {
+		t.Fatalf("Error restoring database: %s", err)
+	}
+	db.Close()
+
+	db = openTestStorageDB(t, storage)
+	defer db.Close()
+	if report := db.Recovery(); report.RecordsApplied != 5 {
+		t.Errorf("Expected a snapshot and 3 records replayed, got %+v", report)
+	}
+	assertDBKeyValue(t, db, "key", "9", true)
+	assertDBKeyValue(t, db, "after", "compaction", true)
+	assertBucketExists(t, db, "b1", true)
+}
+
+func TestStorageFailedAppend(t *testing.T) {
+	fmt.Println("-- TestStorageFailedAppend")
+	storage := &failingStorage{Storage: NewMemoryStorage(), appends: 1}
+	db := openTestStorageDB(t, storage)
+	db.Set("key", "value")
+
+	err := db.ReadWrite(func(tx *Tx) error {
+		tx.Bucket("b1")
+		tx.Set("key", "changed", nil)
+		return tx.Set("other", "value", nil)
+	})
+	if err != errStorageFailed {
+		t.Errorf("Expected error '%s' committing, got '%s'", errStorageFailed, err)
+	}
+	assertDBKeyValue(t, db, "key", "value", true)
+	assertBucketExists(t, db, "b1", false)
+	if exists, _ := db.Exists("other"); exists {
+		t.Errorf("Expected key from the failed transaction to be rolled back")
+	}
+	db.Close()
+
+	db = openTestStorageDB(t, storage.Storage)
+	defer db.Close()
+	assertDBKeyValue(t, db, "key", "value", true)
+}
@@ -3,6 +3,7 @@ package tree
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 )
 
@@ -122,7 +123,12 @@ func (bt *btree) split(node *btnode) error {
 	// 2. Values less than the median are put in the new left node
 	left := newNode(bt, node.parent, nil, node.leftElements(m))
 	// 3. Values greater than the median are put in the new right node, with the median acting as a separation value.
-	right := newNode(bt, node.parent, nil, node.rightElements(m))
+	// Leaves keep the median, since they hold every Node, internal nodes move it up to the parent
+	r := m
+	if !node.isLeaf() {
+		r = m + 1
+	}
+	right := newNode(bt, node.parent, nil, node.rightElements(r))
 
 	if node == bt.root {
 		// assign left and right to the middle node children from the split
@@ -180,27 +186,160 @@ func (bt *btree) findPath(key Key) ([]*btnode, int) {
 }
 
 func (bt *btree) Remove(nodes ...Node) error {
+	for _, n := range nodes {
+		if err := bt.removeNode(n); err != nil {
+			return err
+		}
+		bt.size = bt.size - 1
+	}
 	return nil
 }
 
-func (bt *btree) left() Node {
-	child := func(n []*btnode) int {
-		return 0
+// removeNode removes a Node with the same key and an equal value from its leaf. A leaf left with
+// fewer than the minimum number of elements borrows from a sibling or is merged into one, so the
+// tree shrinks as it empties. Separators are left alone otherwise, they still route to the right
+// leaves even once their keys are gone
+func (bt *btree) removeNode(n Node) error {
+	if bt.root == nil {
+		return ErrKeyNotFound
 	}
-	element := func(e elements) int {
-		return 0
+	path, _ := bt.findPath(n.Key())
+	leaf := path[len(path)-1]
+	idx, found := leaf.find(n.Key())
+	if !found {
+		return ErrKeyNotFound
 	}
-	return getEndNode(bt, child, element)
+
+	e := leaf.elements[idx]
+	for i, other := range e.overflow {
+		if !reflect.DeepEqual(other.Value(), n.Value()) {
+			continue
+		}
+		if len(e.overflow) == 1 {
+			// the element itself is left alone, an internal node may be using it as a separator
+			leaf.deleteElement(idx)
+			bt.list.remove(e.Key(), bt.less)
+			bt.rebalance(leaf)
+			return nil
+		}
+		e.overflow = append(append([]Node{}, e.overflow[:i]...), e.overflow[i+1:]...)
+		return nil
+	}
+	return ErrKeyNotFound
 }
 
-func (bt *btree) right() Node {
-	child := func(n []*btnode) int {
-		return len(n) - 1
+// rebalance fixes a node that's been left with too few elements, borrowing one from a sibling
+// that can spare it or merging it into a sibling otherwise, which takes a separator from the
+// parent and so may leave it needing rebalancing too
+func (bt *btree) rebalance(node *btnode) {
+	if node == bt.root {
+		switch {
+		case node.isLeaf() && len(node.elements) == 0:
+			bt.root = nil
+		case !node.isLeaf() && len(node.elements) == 0:
+			bt.root = node.children[0]
+			bt.root.parent = nil
+		}
+		return
+	}
+	if len(node.elements) >= node.minimumSize() {
+		return
+	}
+
+	parent := node.parent
+	i := parent.childIndex(node)
+	var left, right *btnode
+	if i > 0 {
+		left = parent.children[i-1]
+	}
+	if i < len(parent.children)-1 {
+		right = parent.children[i+1]
+	}
+
+	switch {
+	case left != nil && len(left.elements) > left.minimumSize():
+		bt.borrowLeft(node, left, i)
+	case right != nil && len(right.elements) > right.minimumSize():
+		bt.borrowRight(node, right, i)
+	case left != nil:
+		bt.merge(left, node, i-1)
+	default:
+		bt.merge(node, right, i)
 	}
-	element := func(e elements) int {
-		return len(e) - 1
+}
+
+// borrowLeft moves the last element, and for an internal node the last child, of the node's left
+// sibling into it. i is the node's position in its parent
+func (bt *btree) borrowLeft(node, left *btnode, i int) {
+	parent := node.parent
+	last := left.elements[len(left.elements)-1]
+	left.deleteElement(len(left.elements) - 1)
+	if node.isLeaf() {
+		node.elements = append(elements{last}, node.elements...)
+		parent.elements[i-1] = last
+		return
+	}
+
+	// the parent's separator comes down, and the left sibling's last element replaces it
+	node.elements = append(elements{parent.elements[i-1]}, node.elements...)
+	parent.elements[i-1] = last
+	child := left.children[len(left.children)-1]
+	left.deleteChild(len(left.children) - 1)
+	node.insertChild(child, 0)
+	child.parent = node
+}
+
+// borrowRight moves the first element, and for an internal node the first child, of the node's
+// right sibling into it. i is the node's position in its parent
+func (bt *btree) borrowRight(node, right *btnode, i int) {
+	parent := node.parent
+	first := right.elements[0]
+	right.deleteElement(0)
+	if node.isLeaf() {
+		node.elements = append(node.elements, first)
+		parent.elements[i] = right.elements[0]
+		return
+	}
+
+	// the parent's separator comes down, and the right sibling's first element replaces it
+	node.elements = append(node.elements, parent.elements[i])
+	parent.elements[i] = first
+	child := right.children[0]
+	right.deleteChild(0)
+	node.children = append(node.children, child)
+	child.parent = node
+}
+
+// merge moves everything in right into left, its sibling just before it, and removes right and
+// the separator between them, at position i, from their parent
+func (bt *btree) merge(left, right *btnode, i int) {
+	parent := left.parent
+	if !left.isLeaf() {
+		// internal nodes need the separator to keep one more child than they have elements
+		left.elements = append(left.elements, parent.elements[i])
+		left.children = append(left.children, right.children...)
+		left.assignParent()
+	}
+	left.elements = append(left.elements, right.elements...)
+	parent.deleteElement(i)
+	parent.deleteChild(i + 1)
+	bt.rebalance(parent)
+}
+
+// left is the first Node in the tree, nil if it's empty
+func (bt *btree) left() Node {
+	if len(bt.list) == 0 {
+		return nil
+	}
+	return bt.list[0].overflow[0]
+}
+
+// right is the last Node in the tree, nil if it's empty
+func (bt *btree) right() Node {
+	if len(bt.list) == 0 {
+		return nil
 	}
-	return getEndNode(bt, child, element)
+	return bt.list[len(bt.list)-1].overflow[0]
 }
 
 func (bt *btree) Height() int {
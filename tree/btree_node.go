@@ -38,6 +38,18 @@ func (es *elements) add(e *element, less func(k1, k2 Key) bool) bool {
 	return true
 }
 
+// remove takes the element with the key out of this elements slice, returning if it was there
+func (es *elements) remove(key Key, less func(k1, k2 Key) bool) bool {
+	idx, exists := es.indexOf(key, less)
+	if !exists {
+		return false
+	}
+	copy((*es)[idx:], (*es)[idx+1:])
+	(*es)[len(*es)-1] = nil
+	*es = (*es)[:len(*es)-1]
+	return true
+}
+
 // indexOf returns the index where to put the element, and if it exists
 func (es *elements) indexOf(key Key, less func(k1, k2 Key) bool) (int, bool) {
 	idx := sort.Search(len(*es), func(i int) bool {
@@ -89,6 +101,12 @@ func (bn *btnode) maximumSize() int {
 	return (2 * bn.tree.degree) - 1
 }
 
+// minimumSize is the fewest elements a node other than the root can have, what an internal node
+// is left with when it's split
+func (bn *btnode) minimumSize() int {
+	return bn.tree.degree - 1
+}
+
 func (bn *btnode) median() int {
 	return bn.tree.degree
 }
@@ -150,12 +168,28 @@ func (bn *btnode) insertChild(n *btnode, i int) {
 	bn.children[i] = n
 }
 
+func (bn *btnode) deleteElement(i int) {
+	copy(bn.elements[i:], bn.elements[i+1:])
+	bn.elements[len(bn.elements)-1] = nil
+	bn.elements = bn.elements[:len(bn.elements)-1]
+}
+
 func (bn *btnode) deleteChild(i int) {
 	copy(bn.children[i:], bn.children[i+1:])
 	bn.children[len(bn.children)-1] = nil
 	bn.children = bn.children[:len(bn.children)-1]
 }
 
+// childIndex is the position of child among the node's children, -1 if it isn't one
+func (bn *btnode) childIndex(child *btnode) int {
+	for i, c := range bn.children {
+		if c == child {
+			return i
+		}
+	}
+	return -1
+}
+
 // find determines what position this element would be placed at, or if it's found
 func (bn *btnode) find(key Key) (int, bool) {
 	idx := sort.Search(len(bn.elements), func(i int) bool {
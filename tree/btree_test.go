@@ -2,6 +2,7 @@ package tree
 
 import (
 	"fmt"
+	"math/rand"
 	"testing"
 )
 
@@ -323,6 +324,151 @@ func TestTreeSize(t *testing.T) {
 	}
 }
 
+// TestInternalSplit makes sure internal nodes keep one more child than elements as they split
+func TestInternalSplit(t *testing.T) {
+	fmt.Println("-- TestInternalSplit")
+	btree := getTestTree(testDegree)
+	for _, i := range rand.Perm(500) {
+		btree.Insert(testNode{i})
+	}
+	assertTreeSizing(t, btree.root)
+	for i := 0; i < 500; i++ {
+		nodes, err := btree.Get(i)
+		assertGet(t, 1, i, nodes, err)
+	}
+}
+
+// TestRemove removes nodes, including duplicates and ones that aren't in the tree
+func TestRemove(t *testing.T) {
+	fmt.Println("-- TestRemove")
+	tests := []struct {
+		remove    []int
+		err       error
+		size      uint
+		remaining []int
+	}{
+		{[]int{8}, nil, 22, []int{1, 2, 3, 4, 4, 4, 5, 6, 7, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21}},
+		{[]int{4}, nil, 22, []int{1, 2, 3, 4, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21}},
+		{[]int{4, 4, 4}, nil, 20, []int{1, 2, 3, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21}},
+		{[]int{1, 21}, nil, 21, []int{2, 3, 4, 4, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}},
+		{[]int{4, 4, 4, 4}, ErrKeyNotFound, 20, nil},
+		{[]int{100}, ErrKeyNotFound, 23, nil},
+	}
+	for i, test := range tests {
+		tree := getTestGetTree(3)
+		var nodes []Node
+		for _, v := range test.remove {
+			nodes = append(nodes, testNode{v})
+		}
+		if err := tree.Remove(nodes...); err != test.err {
+			t.Errorf("Test %d failed: expected error %s, got %s", i+1, test.err, err)
+		}
+		if tree.Size() != test.size {
+			t.Errorf("Test %d failed: expected size %d, got %d", i+1, test.size, tree.Size())
+		}
+		if test.err != nil {
+			continue
+		}
+		var remaining []int
+		for n := range tree.IterateAll() {
+			remaining = append(remaining, n.(testNode).v)
+		}
+		if fmt.Sprint(remaining) != fmt.Sprint(test.remaining) {
+			t.Errorf("Test %d failed: expected %v to remain, got %v", i+1, test.remaining, remaining)
+		}
+		for _, v := range test.remaining {
+			if _, err := tree.Get(v); err != nil {
+				t.Errorf("Test %d failed: expected to get %d, got %s", i+1, v, err)
+			}
+		}
+	}
+}
+
+// TestRemoveEverything removes every node in random order while inserting more, then empties the tree
+func TestRemoveEverything(t *testing.T) {
+	fmt.Println("-- TestRemoveEverything")
+	btree := getTestTree(testDegree)
+	expected := make(map[int]bool)
+	for _, i := range rand.Perm(1000) {
+		btree.Insert(testNode{i})
+		expected[i] = true
+		if i%3 == 0 {
+			remove := rand.Intn(1000)
+			if err := btree.Remove(testNode{remove}); (err == nil) != expected[remove] {
+				t.Fatalf("Removing %d: expected it to exist: %t, got error %s", remove, expected[remove], err)
+			}
+			delete(expected, remove)
+		}
+	}
+	assertTreeSizing(t, btree.root)
+	if btree.Size() != uint(len(expected)) {
+		t.Errorf("Expected tree size %d, got %d", len(expected), btree.Size())
+	}
+	previous := -1
+	for n := range btree.IterateAll() {
+		v := n.(testNode).v
+		if !expected[v] || v <= previous {
+			t.Errorf("Unexpected node %d after %d", v, previous)
+		}
+		previous = v
+	}
+
+	for v := range expected {
+		if err := btree.Remove(testNode{v}); err != nil {
+			t.Errorf("Error removing %d: %s", v, err)
+		}
+	}
+	if btree.Size() != 0 || btree.left() != nil || btree.right() != nil {
+		t.Errorf("Expected an empty tree, got size %d", btree.Size())
+	}
+	assertFullIteration(t, btree, 0, 10)
+	btree.Insert(testNode{5})
+	nodes, err := btree.Get(5)
+	assertGet(t, 1, 5, nodes, err)
+}
+
+// TestRemoveChurn keeps inserting new nodes and removing old ones, which shouldn't grow the tree
+func TestRemoveChurn(t *testing.T) {
+	fmt.Println("-- TestRemoveChurn")
+	tests := []struct {
+		degree, live, rounds int
+	}{
+		{3, 100, 50},
+		{4, 500, 10},
+		{10, 1000, 10},
+	}
+	for i, test := range tests {
+		btree := getTestTree(test.degree)
+		for v := 0; v < test.live; v++ {
+			btree.Insert(testNode{v})
+		}
+		nodes := countNodes(btree.root)
+		for v := test.live; v < test.live*test.rounds; v++ {
+			btree.Insert(testNode{v})
+			if err := btree.Remove(testNode{v - test.live}); err != nil {
+				t.Fatalf("Test %d failed: error removing %d: %s", i+1, v-test.live, err)
+			}
+		}
+		assertTreeSizing(t, btree.root)
+		assertMinimumSizing(t, btree.root)
+		if count := countNodes(btree.root); count > 2*nodes {
+			t.Errorf("Test %d failed: expected at most %d nodes after churning, got %d", i+1, 2*nodes, count)
+		}
+		for v := test.live * (test.rounds - 1); v < test.live*test.rounds; v++ {
+			if _, err := btree.Get(v); err != nil {
+				t.Errorf("Test %d failed: expected to get %d, got %s", i+1, v, err)
+			}
+		}
+
+		for _, v := range rand.Perm(test.live) {
+			btree.Remove(testNode{test.live*(test.rounds-1) + v})
+		}
+		if btree.root != nil || btree.Height() != 0 {
+			t.Errorf("Test %d failed: expected no nodes once the tree is empty, got %d", i+1, countNodes(btree.root))
+		}
+	}
+}
+
 // TestElementsFind tests the elements struct
 func TestElementsFind(t *testing.T) {
 	fmt.Println("-- TestElementsFind")
@@ -467,6 +613,44 @@ func assertChildrenElementsSizing(t *testing.T, n *btnode) {
 	}
 }
 
+// assertTreeSizing checks every internal node has one more child than it has elements
+func assertTreeSizing(t *testing.T, n *btnode) {
+	if n.isLeaf() {
+		return
+	}
+	if len(n.children) != len(n.elements)+1 {
+		t.Errorf("incorrect sizing len(children)=%d len(elements)=%d", len(n.children), len(n.elements))
+	}
+	for _, child := range n.children {
+		if child.parent != n {
+			t.Errorf("Expected child's parent to be the node it's a child of")
+		}
+		assertTreeSizing(t, child)
+	}
+}
+
+// assertMinimumSizing checks every node but the root has at least the minimum number of elements
+func assertMinimumSizing(t *testing.T, n *btnode) {
+	for _, child := range n.children {
+		if len(child.elements) < child.minimumSize() {
+			t.Errorf("Expected at least %d elements in a node, got %d", child.minimumSize(), len(child.elements))
+		}
+		assertMinimumSizing(t, child)
+	}
+}
+
+// countNodes is how many nodes are in the tree rooted at n
+func countNodes(n *btnode) int {
+	if n == nil {
+		return 0
+	}
+	count := 1
+	for _, child := range n.children {
+		count += countNodes(child)
+	}
+	return count
+}
+
 func assertGet(t *testing.T, length, key int, nodes []Node, err error) {
 	if err != nil {
 		t.Errorf("Shouldn't have gotten an error, got: %s", err)
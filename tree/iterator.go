@@ -19,7 +19,7 @@ func (bt *btree) Iterate(start, end Key) <-chan Node {
 }
 
 func (bt *btree) iterate(ch chan Node, max uint, start, end Key) {
-	if bt.root == nil {
+	if len(bt.list) == 0 {
 		return
 	}
 
@@ -0,0 +1,181 @@
+package xisdb
+
+import "time"
+
+// NoTTL is the TTL of a key that never expires
+const NoTTL time.Duration = -1
+
+// SetWithTTL sets the key to value, expiring it once the ttl has passed
+func (tx *Tx) SetWithTTL(key, value string, ttl time.Duration) error {
+	if err := tx.checkWrite(); err != nil {
+		return err
+	}
+	return tx.setWithTTL(tx.db.root(), key, value, ttl)
+}
+
+func (tx *Tx) setWithTTL(b *bucket, key, value string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	t := time.Now().Add(ttl)
+	tx.insert(b, &Item{key, value, &itemMetadata{expiration: &t}})
+	return nil
+}
+
+// Expire makes the key expire once d has passed, returning whether or not it exists. A d <= 0
+// deletes the key straight away
+func (tx *Tx) Expire(key string, d time.Duration) (bool, error) {
+	return tx.ExpireAt(key, time.Now().Add(d))
+}
+
+// ExpireAt makes the key expire at t, returning whether or not it exists. A t that's already
+// passed deletes the key straight away
+func (tx *Tx) ExpireAt(key string, t time.Time) (bool, error) {
+	if err := tx.checkWrite(); err != nil {
+		return false, err
+	}
+	return tx.expireAt(tx.db.root(), key, t)
+}
+
+func (tx *Tx) expireAt(b *bucket, key string, t time.Time) (bool, error) {
+	item, exists := tx.lookup(b, key)
+	if !exists {
+		return false, nil
+	}
+	if !t.After(time.Now()) {
+		return tx.delete(b, key)
+	}
+	tx.insert(b, item.withExpiration(&t))
+	return true, nil
+}
+
+// Persist stops the key from expiring, returning whether or not it was going to
+func (tx *Tx) Persist(key string) (bool, error) {
+	if err := tx.checkWrite(); err != nil {
+		return false, err
+	}
+	return tx.persist(tx.db.root(), key)
+}
+
+func (tx *Tx) persist(b *bucket, key string) (bool, error) {
+	item, exists := tx.lookup(b, key)
+	if !exists || item.expiresAt() == 0 {
+		return false, nil
+	}
+	tx.insert(b, item.withExpiration(nil))
+	return true, nil
+}
+
+// TTL is how long until the key expires, NoTTL if it never does, or ErrKeyNotFound
+func (tx *Tx) TTL(key string) (time.Duration, error) {
+	if err := tx.check(); err != nil {
+		return 0, err
+	}
+	return tx.ttl(tx.db.root(), key)
+}
+
+func (tx *Tx) ttl(b *bucket, key string) (time.Duration, error) {
+	item, exists := tx.lookup(b, key)
+	if !exists {
+		return 0, ErrKeyNotFound
+	}
+	if item.expiresAt() == 0 {
+		return NoTTL, nil
+	}
+	if ttl := time.Until(*item.metadata.expiration); ttl > 0 {
+		return ttl, nil
+	}
+	return 0, nil // it's expired, but hasn't been removed yet
+}
+
+// withExpiration copies the item, with its metadata, to expire at t instead, never if t is nil
+func (i *Item) withExpiration(t *time.Time) *Item {
+	md := &itemMetadata{}
+	if i.metadata != nil {
+		*md = *i.metadata
+	}
+	md.expiration = t
+	return &Item{i.Key, i.Value, md}
+}
+
+// SetWithTTL sets the key to value, expiring it once the ttl has passed
+func (b *Bucket) SetWithTTL(key, value string, ttl time.Duration) error {
+	if err := b.tx.checkWrite(); err != nil {
+		return err
+	}
+	return b.tx.setWithTTL(b.managed, key, value, ttl)
+}
+
+// Expire makes the key expire once d has passed, returning whether or not it exists
+func (b *Bucket) Expire(key string, d time.Duration) (bool, error) {
+	return b.ExpireAt(key, time.Now().Add(d))
+}
+
+// ExpireAt makes the key expire at t, returning whether or not it exists
+func (b *Bucket) ExpireAt(key string, t time.Time) (bool, error) {
+	if err := b.tx.checkWrite(); err != nil {
+		return false, err
+	}
+	return b.tx.expireAt(b.managed, key, t)
+}
+
+// Persist stops the key from expiring, returning whether or not it was going to
+func (b *Bucket) Persist(key string) (bool, error) {
+	if err := b.tx.checkWrite(); err != nil {
+		return false, err
+	}
+	return b.tx.persist(b.managed, key)
+}
+
+// TTL is how long until the key expires, NoTTL if it never does, or ErrKeyNotFound
+func (b *Bucket) TTL(key string) (time.Duration, error) {
+	if err := b.tx.check(); err != nil {
+		return 0, err
+	}
+	return b.tx.ttl(b.managed, key)
+}
+
+// SetWithTTL sets the key to value, expiring it once the ttl has passed
+func (db *DB) SetWithTTL(key, value string, ttl time.Duration) error {
+	return db.ReadWrite(func(tx *Tx) error {
+		return tx.SetWithTTL(key, value, ttl)
+	})
+}
+
+// Expire makes the key expire once d has passed, returning whether or not it exists
+func (db *DB) Expire(key string, d time.Duration) (bool, error) {
+	return db.ExpireAt(key, time.Now().Add(d))
+}
+
+// ExpireAt makes the key expire at t, returning whether or not it exists
+func (db *DB) ExpireAt(key string, t time.Time) (bool, error) {
+	var exists bool
+	err := db.ReadWrite(func(tx *Tx) error {
+		e, err := tx.ExpireAt(key, t)
+		exists = e
+		return err
+	})
+	return exists, err
+}
+
+// Persist stops the key from expiring, returning whether or not it was going to
+func (db *DB) Persist(key string) (bool, error) {
+	var persisted bool
+	err := db.ReadWrite(func(tx *Tx) error {
+		p, err := tx.Persist(key)
+		persisted = p
+		return err
+	})
+	return persisted, err
+}
+
+// TTL is how long until the key expires, NoTTL if it never does, or ErrKeyNotFound
+func (db *DB) TTL(key string) (time.Duration, error) {
+	var ttl time.Duration
+	err := db.Read(func(tx *Tx) error {
+		t, err := tx.TTL(key)
+		ttl = t
+		return err
+	})
+	return ttl, err
+}
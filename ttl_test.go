@@ -0,0 +1,262 @@
+package xisdb
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alexsward/xisdb/ql"
+)
+
+// assertTTL checks the key's TTL is within a second of the expected one, which is exact for NoTTL
+func assertTTL(t *testing.T, test int, ttl, expected time.Duration) {
+	if expected == NoTTL && ttl != NoTTL || expected != NoTTL && (ttl > expected || ttl < expected-time.Second) {
+		t.Errorf("Test %d failed: expected a TTL of about %s, got %s", test, expected, ttl)
+	}
+}
+
+func TestTTLOperations(t *testing.T) {
+	fmt.Println("-- TestTTLOperations")
+	tests := []struct {
+		exists   bool
+		ttl      time.Duration
+		op       func(db *DB) (bool, error)
+		err      error
+		result   bool
+		expected time.Duration
+		deleted  bool
+	}{
+		// SetWithTTL
+		{false, 0, func(db *DB) (bool, error) { return true, db.SetWithTTL("key", "value", time.Hour) }, nil, true, time.Hour, false},
+		{true, time.Hour, func(db *DB) (bool, error) { return true, db.SetWithTTL("key", "value", time.Minute) }, nil, true, time.Minute, false},
+		{true, time.Hour, func(db *DB) (bool, error) { return true, db.SetWithTTL("key", "value", 0) }, ErrInvalidTTL, true, time.Hour, false},
+		{false, 0, func(db *DB) (bool, error) { return true, db.SetWithTTL("key", "value", -time.Hour) }, ErrInvalidTTL, true, 0, true},
+		// Expire
+		{true, 0, func(db *DB) (bool, error) { return db.Expire("key", time.Hour) }, nil, true, time.Hour, false},
+		{true, time.Hour, func(db *DB) (bool, error) { return db.Expire("key", time.Minute) }, nil, true, time.Minute, false},
+		{false, 0, func(db *DB) (bool, error) { return db.Expire("key", time.Hour) }, nil, false, 0, true},
+		{true, time.Hour, func(db *DB) (bool, error) { return db.Expire("key", 0) }, nil, true, 0, true},
+		{true, 0, func(db *DB) (bool, error) { return db.Expire("key", -time.Hour) }, nil, true, 0, true},
+		// ExpireAt
+		{true, 0, func(db *DB) (bool, error) { return db.ExpireAt("key", time.Now().Add(time.Hour)) }, nil, true, time.Hour, false},
+		{true, time.Hour, func(db *DB) (bool, error) { return db.ExpireAt("key", time.Now().Add(-time.Hour)) }, nil, true, 0, true},
+		{false, 0, func(db *DB) (bool, error) { return db.ExpireAt("key", time.Now().Add(time.Hour)) }, nil, false, 0, true},
+		// Persist
+		{true, time.Hour, func(db *DB) (bool, error) { return db.Persist("key") }, nil, true, NoTTL, false},
+		{true, 0, func(db *DB) (bool, error) { return db.Persist("key") }, nil, false, NoTTL, false},
+		{false, 0, func(db *DB) (bool, error) { return db.Persist("key") }, nil, false, 0, true},
+	}
+	for i, test := range tests {
+		db := openTestDB()
+		if test.exists {
+			var md *SetMetadata
+			if test.ttl > 0 {
+				md = &SetMetadata{TTL: int64(test.ttl / time.Millisecond)}
+			}
+			db.ReadWrite(func(tx *Tx) error { return tx.Set("key", "value", md) })
+		}
+		result, err := test.op(db)
+		if err != test.err {
+			t.Errorf("Test %d failed: expected error '%v', got '%v'", i+1, test.err, err)
+			continue
+		}
+		if test.err == nil && result != test.result {
+			t.Errorf("Test %d failed: expected result %t, got %t", i+1, test.result, result)
+		}
+		ttl, err := db.TTL("key")
+		if test.deleted {
+			if err != ErrKeyNotFound {
+				t.Errorf("Test %d failed: expected the key to not exist, got '%v'", i+1, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d failed: unexpected error getting the TTL '%s'", i+1, err)
+			continue
+		}
+		assertTTL(t, i+1, ttl, test.expected)
+		assertDBKeyValue(t, db, "key", "value", true)
+	}
+}
+
+func TestTTLTransactions(t *testing.T) {
+	fmt.Println("-- TestTTLTransactions")
+	failure := errors.New("failure")
+	tests := []struct {
+		op       func(tx *Tx) error
+		expected time.Duration
+	}{
+		{func(tx *Tx) error { return tx.SetWithTTL("key", "value", time.Minute) }, time.Minute},
+		{func(tx *Tx) error { _, err := tx.Expire("key", time.Minute); return err }, time.Minute},
+		{func(tx *Tx) error { _, err := tx.ExpireAt("key", time.Now().Add(time.Minute)); return err }, time.Minute},
+		{func(tx *Tx) error { _, err := tx.Persist("key"); return err }, NoTTL},
+	}
+	for i, test := range tests {
+		db := openTestDB()
+		db.SetWithTTL("key", "value", time.Hour)
+
+		// the change is visible in its own transaction, and undone by a rollback
+		err := db.ReadWrite(func(tx *Tx) error {
+			if err := test.op(tx); err != nil {
+				return err
+			}
+			ttl, err := tx.TTL("key")
+			if err != nil {
+				return err
+			}
+			assertTTL(t, i+1, ttl, test.expected)
+			return failure
+		})
+		if err != failure {
+			t.Errorf("Test %d failed: expected error '%s', got '%v'", i+1, failure, err)
+		}
+		ttl, _ := db.TTL("key")
+		assertTTL(t, i+1, ttl, time.Hour)
+
+		// the same goes for an optimistic transaction
+		err = db.Optimistic(func(tx *Tx) error {
+			if err := test.op(tx); err != nil {
+				return err
+			}
+			return failure
+		})
+		if err != failure {
+			t.Errorf("Test %d failed: expected error '%s', got '%v'", i+1, failure, err)
+		}
+		ttl, _ = db.TTL("key")
+		assertTTL(t, i+1, ttl, time.Hour)
+
+		err = db.Read(test.op)
+		if err != ErrNotWriteTransaction {
+			t.Errorf("Test %d failed: expected error '%s', got '%v'", i+1, ErrNotWriteTransaction, err)
+		}
+	}
+}
+
+func TestTTLBuckets(t *testing.T) {
+	fmt.Println("-- TestTTLBuckets")
+	db := openTestDB()
+	err := db.ReadWrite(func(tx *Tx) error {
+		b, err := tx.Bucket("bucket")
+		if err != nil {
+			return err
+		}
+		if err := b.SetWithTTL("key", "value", time.Hour); err != nil {
+			return err
+		}
+		if err := b.Set("other", "value"); err != nil {
+			return err
+		}
+		if exists, err := b.Expire("other", time.Minute); err != nil || !exists {
+			t.Errorf("Expected Expire to return true, nil, got %t, %v", exists, err)
+		}
+		if _, err := tx.TTL("key"); err != ErrKeyNotFound {
+			t.Errorf("Expected the key to not be in the root bucket, got '%v'", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error '%s'", err)
+	}
+	db.ReadWrite(func(tx *Tx) error {
+		b, _ := tx.Bucket("bucket")
+		ttl, _ := b.TTL("key")
+		assertTTL(t, 1, ttl, time.Hour)
+		ttl, _ = b.TTL("other")
+		assertTTL(t, 2, ttl, time.Minute)
+		return nil
+	})
+	db.Read(func(tx *Tx) error {
+		b := &Bucket{tx, db.buckets["bucket"]}
+		if _, err := b.Persist("key"); err != ErrNotWriteTransaction {
+			t.Errorf("Expected error '%s', got '%v'", ErrNotWriteTransaction, err)
+		}
+		return nil
+	})
+}
+
+func TestTTLPersisted(t *testing.T) {
+	fmt.Println("-- TestTTLPersisted")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db := openTestFileDB(t, filename)
+	db.SetWithTTL("expires", "value", time.Hour)
+	db.Set("expiring", "value")
+	db.Expire("expiring", time.Minute)
+	db.Set("persisted", "value")
+	db.Expire("persisted", time.Minute)
+	db.Persist("persisted")
+	db.Set("deleted", "value")
+	db.Expire("deleted", -time.Minute)
+	db.Close()
+
+	db = openTestFileDB(t, filename)
+	defer db.Close()
+	tests := []struct {
+		key      string
+		expected time.Duration
+		err      error
+	}{
+		{"expires", time.Hour, nil},
+		{"expiring", time.Minute, nil},
+		{"persisted", NoTTL, nil},
+		{"deleted", 0, ErrKeyNotFound},
+	}
+	for i, test := range tests {
+		ttl, err := db.TTL(test.key)
+		if err != test.err {
+			t.Errorf("Test %d failed: expected error '%v', got '%v'", i+1, test.err, err)
+			continue
+		}
+		if test.err == nil {
+			assertTTL(t, i+1, ttl, test.expected)
+		}
+	}
+}
+
+func TestTTLQueryLanguage(t *testing.T) {
+	fmt.Println("-- TestTTLQueryLanguage")
+	in := strconv.FormatInt(time.Now().Add(time.Minute).UnixNano()/int64(time.Millisecond), 10)
+	tests := []struct {
+		statement string
+		result    string
+		expected  time.Duration
+	}{
+		{"set key value ttl 60000;", "value", time.Minute},
+		{"expire key 60000;", "true", time.Minute},
+		{"expire missing 60000;", "false", 0},
+		{"expireat key " + in + ";", "true", time.Minute},
+		{"persist key;", "true", NoTTL},
+		{"persist missing;", "false", 0},
+		{"ttl key;", "3600000", time.Hour},
+	}
+	for i, test := range tests {
+		db := openTestDB()
+		db.SetWithTTL("key", "value", time.Hour)
+		statements, err := ql.Parse(test.statement)
+		if err != nil {
+			t.Errorf("Test %d failed: error parsing '%s': %s", i+1, test.statement, err)
+			continue
+		}
+		ch := make(chan Item)
+		qe := QueryEngine{}
+		qe.Execute(statements, &QueryEngineContext{DB: db, Results: ch})
+		select {
+		case item := <-ch:
+			// a TTL may have ticked down a millisecond by the time it's read
+			if item.Value != test.result && !(test.result == "3600000" && item.Value == "3599999") {
+				t.Errorf("Test %d failed: expected result '%s', got '%s'", i+1, test.result, item.Value)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("Test %d failed: timed out waiting for a result", i+1)
+			continue
+		}
+		<-ch
+		if test.expected != 0 {
+			ttl, _ := db.TTL("key")
+			assertTTL(t, i+1, ttl, test.expected)
+		}
+	}
+}
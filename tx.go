@@ -1,6 +1,9 @@
 package xisdb
 
 import (
+	"context"
+	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/alexsward/xisdb/indexes"
@@ -9,51 +12,91 @@ import (
 
 // Tx is a transaction against a database
 type Tx struct {
-	id              int64                    // timestamp, in ns, of the transaction
-	db              *DB                      // the database
-	write           bool                     // if this is a write transaction
-	rollbackBuckets map[string]*bucket       // buckets to rollback
-	rollbacks       map[string]*rollbackInfo // how to roll back the entire transaction
-	commits         map[string]*Item         // commit values
-	hooks           []func()                 // functions to execute upon commit
+	id              int64                     // timestamp, in ns, of the transaction
+	db              *DB                       // the database
+	ctx             context.Context           // once it's done the transaction can't be used
+	write           bool                      // if this is a write transaction
+	version         int64                     // the version of the data read, or for a write transaction the one it commits
+	rollbackBuckets map[string]*bucket        // buckets to rollback
+	rollbacks       map[*bucket]*rollbackInfo // how to roll back the entire transaction
+	commits         []*commit                 // changes to persist, in order
+	hooks           []func()                  // functions to execute upon commit
+	savepoints      []*savepoint              // savepoints that can be rolled back to, oldest first
+	optimistic      *optimistic               // what an optimistic transaction has read and written, nil otherwise
+	managed         bool                      // if it's run by Read or ReadWrite, which commit or roll it back
 	closed          bool
 }
 
 type rollbackInfo struct {
-	items   map[string]*Item
-	indexes map[string][]*Item
+	items    map[string]*Item  // items as they were before the transaction, nil if they didn't exist
+	replaced map[string]*index // indexes as they were before the transaction, nil if they didn't exist
 }
 
 func newRollbackInfo() *rollbackInfo {
 	return &rollbackInfo{
-		items:   make(map[string]*Item),
-		indexes: make(map[string][]*Item),
+		items:    make(map[string]*Item),
+		replaced: make(map[string]*index),
 	}
 }
 
-// NewTransaction creates a new transaction against the DB
+// NewTransaction creates a new transaction against the DB. It reads the last committed version
+// of the data, and if it's a write transaction its changes are the next version
 func NewTransaction(writeable bool, db *DB) *Tx {
+	var version int64
+	if db != nil {
+		version = atomic.LoadInt64(&db.version)
+		if writeable {
+			version++
+		}
+	}
 	return &Tx{
 		id:              time.Now().UnixNano(),
 		db:              db,
+		ctx:             context.Background(),
 		write:           writeable,
-		rollbacks:       make(map[string]*rollbackInfo),
+		version:         version,
+		rollbacks:       make(map[*bucket]*rollbackInfo),
 		rollbackBuckets: make(map[string]*bucket),
-		commits:         make(map[string]*Item),
+		commits:         make([]*commit, 0),
 		hooks:           make([]func(), 0),
 	}
 }
 
-func (tx *Tx) addRollback(bucket, key string, item *Item) {
+// snapshot is the version of the data the transaction reads. Write transactions hold the
+// database locked, so they read the newest version of everything, including their own changes
+func (tx *Tx) snapshot() int64 {
+	if tx.write {
+		return latest
+	}
+	return tx.version
+}
+
+// ID is the transaction's id: the time, in unix nanoseconds, it began. Write transactions
+// are given increasing ids in the order they commit, so time.Unix(0, id) of one can be used
+// to restore the database to right after it
+func (tx *Tx) ID() int64 {
+	return tx.id
+}
+
+// addRollback records how the item was before it's changed, both for the transaction
+// and for every savepoint, which each roll back to how it was when they were made
+func (tx *Tx) addRollback(bucket *bucket, key string, item *Item) {
 	if !tx.write {
 		return
 	}
 
-	if _, exists := tx.rollbacks[bucket]; !exists {
-		tx.rollbacks[bucket] = newRollbackInfo()
+	addRollbackItem(tx.rollbacks, bucket, key, item)
+	for _, sp := range tx.savepoints {
+		addRollbackItem(sp.rollbacks, bucket, key, item)
 	}
+}
 
-	if _, exists := tx.rollbacks[bucket].items[key]; exists {
+func addRollbackItem(rollbacks map[*bucket]*rollbackInfo, bucket *bucket, key string, item *Item) {
+	if _, exists := rollbacks[bucket]; !exists {
+		rollbacks[bucket] = newRollbackInfo()
+	}
+
+	if _, exists := rollbacks[bucket].items[key]; exists {
 		// this item has been added to be rolled back once, don't do it again
 		// for example:
 		//		db.Get("key") = "value"
@@ -61,28 +104,141 @@ func (tx *Tx) addRollback(bucket, key string, item *Item) {
 		//    --> don't rollback to value1
 		return
 	}
-	tx.rollbacks[bucket].items[key] = item
+	rollbacks[bucket].items[key] = item
+}
+
+func (tx *Tx) addRollbackIndex(bucket *bucket, name string, idx *index) {
+	addRollbackIndex(tx.rollbacks, bucket, name, idx)
+	for _, sp := range tx.savepoints {
+		addRollbackIndex(sp.rollbacks, bucket, name, idx)
+	}
+}
+
+func addRollbackIndex(rollbacks map[*bucket]*rollbackInfo, bucket *bucket, name string, idx *index) {
+	if _, exists := rollbacks[bucket]; !exists {
+		rollbacks[bucket] = newRollbackInfo()
+	}
+	if _, exists := rollbacks[bucket].replaced[name]; exists {
+		return
+	}
+	rollbacks[bucket].replaced[name] = idx
 }
 
 func (tx *Tx) addRollbackBucket(bucket string, b *bucket) {
-	if _, exists := tx.rollbackBuckets[bucket]; exists {
+	addRollbackBucket(tx.rollbackBuckets, bucket, b)
+	for _, sp := range tx.savepoints {
+		addRollbackBucket(sp.rollbackBuckets, bucket, b)
+	}
+}
+
+func addRollbackBucket(rollbackBuckets map[string]*bucket, bucket string, b *bucket) {
+	if _, exists := rollbackBuckets[bucket]; exists {
 		// don't perform additional rollbacks for a bucket
 		// delta from first change is what to roll back to
 		return
 	}
-	tx.rollbackBuckets[bucket] = b
+	rollbackBuckets[bucket] = b
+}
+
+func (tx *Tx) addCommit(op opType, bucket string, item *Item) {
+	tx.commits = append(tx.commits, &commit{op: op, bucket: bucket, item: item})
+}
+
+func (tx *Tx) addIndexCommit(op opType, bucket string, def *IndexDefinition) {
+	tx.commits = append(tx.commits, &commit{op: op, bucket: bucket, index: def})
+}
+
+// Commit ends the transaction, committing its changes as a new version of the data if it's
+// a write transaction and running its hooks. If the changes can't be persisted they're rolled
+// back and the error is returned. Either way the transaction is closed and the database released
+func (tx *Tx) Commit() error {
+	if err := tx.end(); err != nil {
+		return err
+	}
+	db := tx.db
+	defer tx.close()
+
+	if tx.optimistic != nil {
+		defer db.done(tx)
+		return db.commitOptimistic(tx)
+	}
+	if !tx.write {
+		defer db.done(tx)
+		return db.commit(tx)
+	}
+	return db.commitWrite(tx)
+}
+
+// Rollback ends the transaction, undoing all of its changes if it's a write transaction.
+// The transaction is closed and the database released
+func (tx *Tx) Rollback() error {
+	if err := tx.end(); err != nil {
+		return err
+	}
+	db := tx.db
+	defer tx.close()
+
+	if !tx.write {
+		db.done(tx)
+		return nil
+	}
+	return db.rollback(tx)
+}
+
+// end makes sure the transaction can be committed or rolled back by the caller, even once its context is done
+func (tx *Tx) end() error {
+	if err := tx.open(); err != nil {
+		return err
+	}
+	if tx.managed {
+		return ErrTxManaged
+	}
+	return nil
+}
+
+// check makes sure the transaction can still be used
+func (tx *Tx) check() error {
+	if err := tx.open(); err != nil {
+		return err
+	}
+	return tx.ctx.Err()
+}
+
+// checkWrite makes sure the transaction can still be used, and can write
+func (tx *Tx) checkWrite() error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	if !tx.write && tx.optimistic == nil {
+		return ErrNotWriteTransaction
+	}
+	return nil
+}
+
+// open makes sure the transaction hasn't been ended
+func (tx *Tx) open() error {
+	if tx.closed {
+		return ErrTxClosed
+	}
+	if tx.db == nil {
+		return ErrNoDatabase
+	}
+	return nil
 }
 
-func (tx *Tx) addCommit(key string, item *Item) {
-	tx.commits[key] = item
+// Context returns the transaction's context, context.Background() unless it was
+// started with ReadContext or ReadWriteContext
+func (tx *Tx) Context() context.Context {
+	return tx.ctx
 }
 
 func (tx *Tx) close() {
 	tx.db = nil
-	tx.rollbacks = make(map[string]*rollbackInfo)
+	tx.rollbacks = make(map[*bucket]*rollbackInfo)
 	tx.rollbackBuckets = make(map[string]*bucket)
-	tx.commits = make(map[string]*Item)
+	tx.commits = make([]*commit, 0)
 	tx.hooks = make([]func(), 0)
+	tx.savepoints = nil
 	tx.closed = true
 }
 
@@ -98,14 +254,33 @@ type SetMetadata struct {
 
 // Bucket adds a bucket to the database by name
 func (tx *Tx) Bucket(name string) (*Bucket, error) {
-	if tx.db == nil {
-		return nil, ErrNoDatabase
+	return tx.bucket(name, nil)
+}
+
+// bucket finds the bucket by name, creating it with the options if it doesn't exist. Options
+// that are given must match those of a bucket that already exists
+func (tx *Tx) bucket(name string, opts *BucketOptions) (*Bucket, error) {
+	if err := tx.check(); err != nil {
+		return nil, err
 	}
 	if !tx.write {
 		return nil, ErrNotWriteTransaction
 	}
 
-	bucket, _ := tx.db.addBucket(name)
+	var options BucketOptions
+	if opts != nil {
+		options = *opts
+	}
+	bucket, created := tx.db.addBucket(name, options)
+	if created {
+		tx.addRollbackBucket(name, nil)
+		tx.addCommit(opCreateBucket, name, nil)
+		if options != (BucketOptions{}) {
+			tx.commits = append(tx.commits, &commit{op: opBucketOptions, bucket: name, options: &options})
+		}
+	} else if opts != nil && bucket.options != options {
+		return nil, ErrBucketOptionsMismatch
+	}
 	b := &Bucket{
 		tx:      tx,
 		managed: bucket,
@@ -115,21 +290,27 @@ func (tx *Tx) Bucket(name string) (*Bucket, error) {
 
 // DeleteBucket deletes a bucket from the database, if it exists. Returns whether or not it was deleted
 func (tx *Tx) DeleteBucket(name string) (bool, error) {
-	if tx.db == nil {
-		return false, ErrNoDatabase
+	if err := tx.check(); err != nil {
+		return false, err
 	}
 	if !tx.write {
 		return false, ErrNotWriteTransaction
 	}
 
-	return tx.db.deleteBucket(name)
+	bucket := tx.db.buckets[name]
+	deleted, err := tx.db.deleteBucket(name)
+	if deleted && err == nil {
+		tx.addRollbackBucket(name, bucket)
+		tx.addCommit(opDeleteBucket, name, nil)
+	}
+	return deleted, err
 }
 
 // Buckets returns all buckets in the database. The root bucket will be first no matter what
 func (tx *Tx) Buckets() ([]*Bucket, error) {
 	var buckets []*Bucket
-	if tx.db == nil {
-		return buckets, ErrNoDatabase
+	if err := tx.check(); err != nil {
+		return buckets, err
 	}
 	if !tx.write {
 		return buckets, ErrNotWriteTransaction
@@ -147,15 +328,15 @@ func (tx *Tx) Buckets() ([]*Bucket, error) {
 
 // Get retrieves a value from the database, if it exists
 func (tx *Tx) Get(key string) (string, error) {
-	if tx.db == nil {
-		return "", ErrNoDatabase
+	if err := tx.check(); err != nil {
+		return "", err
 	}
 
 	return tx.get(tx.db.root(), key)
 }
 
 func (tx *Tx) get(b *bucket, key string) (string, error) {
-	item, exists := b.get(key)
+	item, exists := tx.lookup(b, key)
 	if !exists {
 		return "", ErrKeyNotFound
 	}
@@ -164,85 +345,130 @@ func (tx *Tx) get(b *bucket, key string) (string, error) {
 
 // Exists tells you if a key exists
 func (tx *Tx) Exists(key string) (bool, error) {
-	if tx.db == nil {
-		return false, ErrNoDatabase
+	if err := tx.check(); err != nil {
+		return false, err
 	}
 	return tx.exists(tx.db.root(), key)
 }
 
 func (tx *Tx) exists(b *bucket, key string) (bool, error) {
-	return b.exists(key), nil
+	_, exists := tx.lookup(b, key)
+	return exists, nil
+}
+
+// lookup finds the item as the transaction sees it. An expired item isn't there, and a write
+// transaction deletes it in place
+func (tx *Tx) lookup(b *bucket, key string) (*Item, bool) {
+	item, exists := tx.find(b, key)
+	if !exists || !tx.expired(item) {
+		return item, exists
+	}
+	if tx.write {
+		tx.remove(b, key, item, true)
+	}
+	return nil, false
+}
+
+// find is lookup without expiring anything
+func (tx *Tx) find(b *bucket, key string) (*Item, bool) {
+	if tx.optimistic != nil {
+		return tx.optimistic.lookup(b, key, tx.version)
+	}
+	return b.get(key, tx.snapshot())
+}
+
+// expired tells you if the item has expired, never when expiration is disabled
+func (tx *Tx) expired(item *Item) bool {
+	return tx.db.expires && item.expired(time.Now())
 }
 
 // Set will add or update a key in the database
 func (tx *Tx) Set(key, value string, md *SetMetadata) error {
-	if tx.db == nil {
-		return ErrNoDatabase
-	}
-	if !tx.write {
-		return ErrNotWriteTransaction
+	if err := tx.checkWrite(); err != nil {
+		return err
 	}
 
 	return tx.set(tx.db.root(), key, value, md)
 }
 
 func (tx *Tx) set(b *bucket, key, value string, md *SetMetadata) error {
-	var oldValue *Item
-	if actual, exists := b.get(key); exists {
-		oldValue = actual
-	}
-	tx.addRollback(b.name, key, oldValue)
-
-	imd := &itemMetadata{}
+	imd := &itemMetadata{expiration: b.defaultExpiration()}
 	if md != nil && md.TTL > 0 {
 		t := time.Now().Add(time.Millisecond * time.Duration(md.TTL))
 		imd.expiration = &t
 	}
 
-	item := Item{key, value, imd}
-	b.insert(&item)
-	tx.addCommit(key, &item)
-
+	tx.insert(b, &Item{key, value, imd})
 	return nil
 }
 
+// insert adds the item to the bucket as-is, including its metadata
+func (tx *Tx) insert(b *bucket, item *Item) {
+	if tx.optimistic != nil {
+		tx.optimistic.write(item.Key, item)
+		return
+	}
+
+	// an expired key is deleted first, so it's reported as expiring before it's set again
+	old, _ := tx.lookup(b, item.Key)
+	tx.addRollback(b, item.Key, old)
+	b.insert(item, tx.version)
+	tx.addCommit(opSet, b.name, item)
+}
+
 // Delete removes a key entirely from the database, if it exists
 func (tx *Tx) Delete(key string) (bool, error) {
-	if tx.db == nil {
-		return false, ErrNoDatabase
-	}
-	if !tx.write {
-		return false, ErrNotWriteTransaction
+	if err := tx.checkWrite(); err != nil {
+		return false, err
 	}
 	return tx.delete(tx.db.root(), key)
 }
 
 func (tx *Tx) delete(b *bucket, key string) (bool, error) {
-	if !b.exists(key) {
-		tx.rollbacks[key] = nil
+	item, exists := tx.lookup(b, key)
+	if !exists {
 		return false, ErrKeyNotFound
 	}
+	return tx.remove(b, key, item, false), nil
+}
+
+// remove deletes the key, which the transaction sees as the item. When it's deleted because it
+// expired the item is kept with the commit, so the expiration can be reported with its final value
+func (tx *Tx) remove(b *bucket, key string, item *Item, expired bool) bool {
+	if tx.optimistic != nil {
+		tx.optimistic.write(key, nil)
+		return true
+	}
 
-	item, _ := b.get(key)
-	tx.addRollback(b.name, key, item)
-	tx.addCommit(key, nil)
-	return b.delete(key), nil
+	tx.addRollback(b, key, item)
+	if expired {
+		tx.commits = append(tx.commits, &commit{op: opDelete, bucket: b.name, item: item, expired: true})
+	} else {
+		tx.addCommit(opDelete, b.name, &Item{Key: key})
+	}
+	return b.delete(key, tx.version)
 }
 
 func (tx *Tx) clear(b *bucket) error {
-	if tx.db == nil {
-		return ErrNoDatabase
+	if err := tx.check(); err != nil {
+		return err
 	}
 	if !tx.write {
 		return ErrNotWriteTransaction
 	}
-	return b.clear()
+
+	for _, item := range b.items(tx.snapshot()) {
+		if _, err := tx.delete(b, item.Key); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // AddIndex creates a new index in the database using a read-write transaction
 func (tx *Tx) AddIndex(name string, it IndexType, m indexes.Matcher, c tree.Comparator) error {
-	if tx.db == nil {
-		return ErrNoDatabase
+	if err := tx.check(); err != nil {
+		return err
 	}
 
 	if !tx.write {
@@ -259,39 +485,135 @@ func (tx *Tx) AddIndex(name string, it IndexType, m indexes.Matcher, c tree.Comp
 		return err
 	}
 
-	for _, value := range b.data {
-		if !idx.match(&value) {
-			continue
-		}
-		idx.add(&value)
+	idx.build(b, tx.snapshot())
+	tx.addRollbackIndex(b, name, nil)
+	b.setIndex(name, idx)
+	return nil
+}
+
+// CreateIndex creates a new index in the database from its definition using a read-write
+// transaction. Unlike AddIndex the index is persisted, and rebuilt whenever the database is opened
+func (tx *Tx) CreateIndex(def IndexDefinition) error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	if !tx.write {
+		return ErrNotWriteTransaction
+	}
+
+	b := tx.db.root()
+	if _, exists := b.indexes[def.Name]; exists {
+		return ErrIndexAlreadyExists
 	}
-	b.indexes[name] = idx
+	return tx.createIndex(b, &def)
+}
+
+func (tx *Tx) createIndex(b *bucket, def *IndexDefinition) error {
+	idx, err := newDefinedIndex(def)
+	if err != nil {
+		return err
+	}
+
+	idx.build(b, tx.snapshot())
+	tx.addRollbackIndex(b, def.Name, b.indexes[def.Name])
+	b.setIndex(def.Name, idx)
+	tx.addIndexCommit(opCreateIndex, b.name, def)
 	return nil
 }
 
 // DeleteIndex will delete an index from the database by name, if it exists
 func (tx *Tx) DeleteIndex(name string) (bool, error) {
-	if tx.db == nil {
-		return false, ErrNoDatabase
+	if err := tx.check(); err != nil {
+		return false, err
 	}
-	b := tx.db.root()
-	_, exists := b.indexes[name]
-	if exists {
-		delete(b.indexes, name)
+	if !tx.write {
+		return false, ErrNotWriteTransaction
 	}
-	return exists, nil
+	return tx.deleteIndex(tx.db.root(), name), nil
 }
 
-func (tx *Tx) iterate(indexName string, limit int) (<-chan Item, error) {
-	if tx.db == nil {
-		return nil, ErrNoDatabase
+func (tx *Tx) deleteIndex(b *bucket, name string) bool {
+	idx, exists := b.indexes[name]
+	if !exists {
+		return false
 	}
 
-	b := tx.db.root()
-	idx, exists := b.indexes[indexName]
+	tx.addRollbackIndex(b, name, idx)
+	b.setIndex(name, nil)
+	if idx.definition != nil {
+		tx.addIndexCommit(opDeleteIndex, b.name, &IndexDefinition{Name: name})
+	}
+	return true
+}
+
+// iterate returns the items in the bucket's index, in its order, up to limit of them if it's > 0
+func (tx *Tx) iterate(b *bucket, indexName string, limit int) (<-chan Item, error) {
+	if err := tx.check(); err != nil {
+		return nil, err
+	}
+
+	idx, exists := b.index(indexName)
 	if !exists {
 		return nil, ErrIndexDoesNotExist
 	}
 
-	return idx.iterate(), nil
+	// indexes only hold the newest items, including ones written by transactions that haven't
+	// committed yet, so a transaction can only go by them if it's the writer or nothing's been
+	// written since its version. Anything else finds the items that match as of its version and
+	// puts them in the index's order
+	b.mutex.RLock()
+	if tx.write || tx.current() {
+		var keys []string
+		for item := range idx.iterate() {
+			keys = append(keys, item.Key)
+		}
+		b.mutex.RUnlock()
+		return buffered(tx.resolve(b, keys, limit)), nil
+	}
+	b.mutex.RUnlock()
+
+	var items []Item
+	for _, found := range b.items(tx.snapshot()) {
+		if item, exists := tx.lookup(b, found.Key); exists && idx.match(item) {
+			items = append(items, *item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return idx.compare(items[i].Key, items[j].Key) < 0
+	})
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	return buffered(items), nil
+}
+
+// current tells you if the data is still as of the transaction's version, with nothing committed
+// since and no write transaction changing it. An optimistic transaction's own writes are kept
+// to itself, so it never is. Holding a bucket's mutex keeps it current, as far as that bucket goes
+func (tx *Tx) current() bool {
+	return tx.optimistic == nil && len(tx.db.writer) == 0 && atomic.LoadInt64(&tx.db.version) == tx.version
+}
+
+// buffered returns a closed channel holding the items
+func buffered(items []Item) <-chan Item {
+	ch := make(chan Item, len(items))
+	for _, item := range items {
+		ch <- item
+	}
+	close(ch)
+	return ch
+}
+
+// resolve looks up each of the keys in order, up to limit of the ones that exist if it's > 0
+func (tx *Tx) resolve(b *bucket, keys []string, limit int) []Item {
+	var items []Item
+	for _, key := range keys {
+		if limit > 0 && len(items) == limit {
+			break
+		}
+		if item, exists := tx.lookup(b, key); exists {
+			items = append(items, *item)
+		}
+	}
+	return items
 }
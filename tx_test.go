@@ -2,7 +2,9 @@ package xisdb
 
 import (
 	"fmt"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/alexsward/xisdb/indexes"
 )
@@ -151,12 +153,12 @@ func TestTxGet(t *testing.T) {
 		err             error
 	}{
 		{"key", "value", "key", false, nil},
-		{"key", "value", "key", true, ErrNoDatabase},
+		{"key", "value", "key", true, ErrTxClosed},
 		{"key", "value", "unknown", false, ErrKeyNotFound},
 	}
 	for i, test := range tests {
 		db := openTestDB()
-		db.root().data[test.set] = Item{Key: test.set, Value: test.value}
+		db.root().insert(&Item{Key: test.set, Value: test.value}, 0)
 		tx := NewTransaction(false, db)
 		if test.close {
 			tx.close()
@@ -184,7 +186,7 @@ func TestTxExists(t *testing.T) {
 	}{
 		{"key", false, true, true, nil},
 		{"key", false, false, false, nil},
-		{"key", true, false, false, ErrNoDatabase},
+		{"key", true, false, false, ErrTxClosed},
 	}
 	for i, test := range tests {
 		db := openTestDB()
@@ -217,7 +219,7 @@ func TestTxSet(t *testing.T) {
 		err          error
 	}{
 		{"key", "value", true, false, nil},
-		{"key", "value", true, true, ErrNoDatabase},
+		{"key", "value", true, true, ErrTxClosed},
 		{"key", "value", false, false, ErrNotWriteTransaction},
 	}
 	for i, test := range tests {
@@ -234,9 +236,10 @@ func TestTxSet(t *testing.T) {
 		if test.err != nil {
 			continue
 		}
-		val, ok := db.root().data[test.set]
+		val, ok := db.root().get(test.set, latest)
 		if !ok {
 			t.Errorf("Test %d failed: key not found", i+1)
+			continue
 		}
 		if val.Value != test.value {
 			t.Errorf("Test %d failed: expected value '%s', got '%s'", i+1, test.value, val.Value)
@@ -252,7 +255,7 @@ func TestTxDelete(t *testing.T) {
 		err                   error
 	}{
 		{"key", "value", "key", true, false, true, nil},
-		{"key", "value", "key", true, true, false, ErrNoDatabase},
+		{"key", "value", "key", true, true, false, ErrTxClosed},
 		{"key", "value", "key", false, false, true, ErrNotWriteTransaction},
 		{"key", "value", "key2", true, false, false, ErrKeyNotFound},
 	}
@@ -275,7 +278,7 @@ func TestTxDelete(t *testing.T) {
 			t.Errorf("Test %d failed: expected deleted:%t, got:%t", i+1, test.deleted, deleted)
 			continue
 		}
-		_, found := db.root().data[test.remove]
+		_, found := db.root().get(test.remove, latest)
 		if found {
 			t.Errorf("Expected to not still find the data")
 		}
@@ -286,14 +289,15 @@ func TestTxAddRollback(t *testing.T) {
 	fmt.Println("-- TestTxAddRollback")
 	db := openTestDB()
 	tx := NewTransaction(false, db)
-	tx.addRollback("", "key", nil)
+	tx.addRollback(db.root(), "key", nil)
 	if len(tx.rollbacks) != 0 {
 		t.Errorf("Expected no rollbacks added to read-only transaction, got 1")
 	}
 	tx = NewTransaction(true, db)
-	tx.addRollback("bucket", "key", nil)
-	tx.addRollback("bucket", "key", &Item{"key", "value1", nil})
-	tx.addRollback("bucket", "key", &Item{"key", "value2", nil})
+	b := newBucket("bucket", db)
+	tx.addRollback(b, "key", nil)
+	tx.addRollback(b, "key", &Item{"key", "value1", nil})
+	tx.addRollback(b, "key", &Item{"key", "value2", nil})
 	if len(tx.rollbacks) != 1 {
 		t.Errorf("Expected single rollback bucket, got %d", len(tx.rollbacks))
 	}
@@ -305,8 +309,8 @@ func TestTxAddIndexErrors(t *testing.T) {
 	tx := NewTransaction(true, db)
 	tx.close()
 	err := tx.AddIndex("", KeyIndex, nil, nil)
-	if err != ErrNoDatabase {
-		t.Errorf("Expected error adding index to closed transaction: '%s', got '%s'", ErrNoDatabase, err)
+	if err != ErrTxClosed {
+		t.Errorf("Expected error adding index to closed transaction: '%s', got '%s'", ErrTxClosed, err)
 	}
 	tx = NewTransaction(false, db)
 	err = tx.AddIndex("index", KeyIndex, nil, nil)
@@ -381,3 +385,103 @@ func TestTxAddIndexKeyWildCard(t *testing.T) {
 		}
 	}
 }
+
+func TestTxBeginCommit(t *testing.T) {
+	fmt.Println("-- TestTxBeginCommit")
+	filename := filepath.Join(t.TempDir(), "test.data")
+	db := openTestFileDB(t, filename)
+	tx, err := db.Begin(true)
+	if err != nil {
+		t.Fatalf("Error beginning transaction: %s", err)
+	}
+	tx.Set("key", "value", nil)
+	b, _ := tx.Bucket("b1")
+	b.Set("bucketkey", "value")
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Error committing transaction: %s", err)
+	}
+
+	tests := []struct {
+		name string
+		fn   func() error
+	}{
+		{"Commit", tx.Commit},
+		{"Rollback", tx.Rollback},
+		{"Set", func() error { return tx.Set("key", "other", nil) }},
+		{"Get", func() error { _, err := tx.Get("key"); return err }},
+		{"Bucket.Set", func() error { return b.Set("bucketkey", "other") }},
+	}
+	for i, test := range tests {
+		if err := test.fn(); err != ErrTxClosed {
+			t.Errorf("Test %d failed: expected error '%s' from %s, got '%v'", i+1, ErrTxClosed, test.name, err)
+		}
+	}
+	db.Close()
+
+	db = openTestFileDB(t, filename)
+	defer db.Close()
+	assertDBKeyValue(t, db, "key", "value", true)
+	assertBucketExists(t, db, "b1", true)
+}
+
+func TestTxBeginRollback(t *testing.T) {
+	fmt.Println("-- TestTxBeginRollback")
+	db := openTestDB()
+	db.Set("key", "value")
+
+	tx, _ := db.Begin(true)
+	tx.Set("key", "changed", nil)
+	tx.Set("other", "value", nil)
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Error rolling back transaction: %s", err)
+	}
+	assertDBKeyValue(t, db, "key", "value", true)
+	if exists, _ := db.Exists("other"); exists {
+		t.Errorf("Expected key from the rolled back transaction to not exist")
+	}
+
+	// read transactions can be open together, and both ways of ending them unlock the database
+	first, _ := db.Begin(false)
+	second, _ := db.Begin(false)
+	if value, _ := second.Get("key"); value != "value" {
+		t.Errorf("Expected value 'value' in a read transaction, got '%s'", value)
+	}
+	first.Commit()
+	second.Rollback()
+
+	done := make(chan error)
+	go func() {
+		done <- db.Set("key", "after")
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Error writing after transactions ended: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the database to be unlocked once transactions ended")
+	}
+}
+
+func TestTxBeginErrors(t *testing.T) {
+	fmt.Println("-- TestTxBeginErrors")
+	db := openTestDB()
+	db.ReadWrite(func(tx *Tx) error {
+		if err := tx.Commit(); err != ErrTxManaged {
+			t.Errorf("Expected error '%s' committing a managed transaction, got '%v'", ErrTxManaged, err)
+		}
+		if err := tx.Rollback(); err != ErrTxManaged {
+			t.Errorf("Expected error '%s' rolling back a managed transaction, got '%v'", ErrTxManaged, err)
+		}
+		return nil
+	})
+
+	readOnly, _ := Open(&Options{InMemory: true, ReadOnly: true, BackgroundInterval: -1})
+	if _, err := readOnly.Begin(true); err != ErrDatabaseReadOnly {
+		t.Errorf("Expected error '%s' beginning a write transaction, got '%v'", ErrDatabaseReadOnly, err)
+	}
+	db.Close()
+	if _, err := db.Begin(false); err != ErrDatabaseClosed {
+		t.Errorf("Expected error '%s' beginning on a closed database, got '%v'", ErrDatabaseClosed, err)
+	}
+}
@@ -17,6 +17,14 @@ func (db *DB) Bucket(name string) error {
 	})
 }
 
+// BucketWithOptions will create a bucket with the options, if it doesn't exist
+func (db *DB) BucketWithOptions(name string, opts BucketOptions) error {
+	return db.ReadWrite(func(tx *Tx) error {
+		_, err := tx.BucketWithOptions(name, opts)
+		return err
+	})
+}
+
 // DeleteBucket will delete a bucket from the database, if it exists
 func (db *DB) DeleteBucket(name string) error {
 	return db.ReadWrite(func(tx *Tx) error {
@@ -82,6 +90,14 @@ func (db *DB) AddIndex(name string, it IndexType, m indexes.Matcher, c tree.Comp
 	})
 }
 
+// CreateIndex will add an index to the database from its definition. The index is persisted,
+// so its matcher and comparator must be registered by name whenever the database is opened
+func (db *DB) CreateIndex(def IndexDefinition) error {
+	return db.ReadWrite(func(tx *Tx) error {
+		return tx.CreateIndex(def)
+	})
+}
+
 // DeleteIndex will remove an index by name, if it exists.
 // Returns whether or not it was deleted along with any error that may have occured
 func (db *DB) DeleteIndex(name string) (bool, error) {